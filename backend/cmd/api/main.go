@@ -2,18 +2,34 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/server"
 )
 
 func main() {
-	server := server.NewServer()
+	cfg, args, err := config.Load("api", os.Args[1:])
+	if err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, "\n"+migrateUsage)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrate(cfg, args[1:])
+		return
+	}
+
+	server := server.NewServer(cfg)
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -29,7 +45,7 @@ func main() {
 	<-done
 	log.Print("server stopped")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/database"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/migrate"
+	"github.com/nikhilsahni7/typeMaster/backend/migrations"
+)
+
+const migrateUsage = `usage: api [flags] migrate <command>
+
+commands:
+  up                apply every pending migration
+  down [n]          roll back the last n migrations (default 1)
+  status            list applied and pending migrations
+  baseline <n>      mark migrations up to n as applied without running them,
+                    for a schema that was set up by hand`
+
+// runMigrate handles `api migrate ...`
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	db, err := database.NewPostgres(cfg.Postgres)
+	if err != nil {
+		log.Fatalf("cannot connect to database: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.Files)
+	if err != nil {
+		log.Fatalf("cannot load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			log.Printf("Applied %03d_%s", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Print("Nothing to apply")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			log.Printf("Rolled back %03d_%s", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+
+	case "status":
+		history, err := m.History(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		version := 0
+		for _, a := range history {
+			fmt.Printf("applied  %03d_%s  %s\n", a.Version, a.Name, a.AppliedAt)
+			version = a.Version
+		}
+		if _, err := m.Check(ctx); err != nil {
+			log.Fatal(err)
+		}
+		for _, mig := range m.Migrations() {
+			if mig.Version > version {
+				fmt.Printf("pending  %03d_%s\n", mig.Version, mig.Name)
+			}
+		}
+
+	case "baseline":
+		if len(args) < 2 {
+			log.Fatal("baseline needs a version")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 1 {
+			log.Fatalf("invalid version %q", args[1])
+		}
+		if err := m.Baseline(ctx, version); err != nil {
+			log.Fatalf("migrate baseline: %v", err)
+		}
+		log.Printf("Recorded migrations up to %d as applied", version)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,79 @@
+// Command leaderboard_repair rebuilds every leaderboard in Redis from the
+// verified results in the matches table. Run it after a Redis data loss, or
+// once after upgrading to boards keyed by user ID to drop the old
+// username:userID entries. It is safe to run while the API is serving:
+// results saved during the rebuild are applied again once it is in place.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/database"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// How far before the scan to look for results to apply again
+const catchUpMargin = time.Minute
+
+func main() {
+	cfg, _, err := config.Load("leaderboard_repair", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		log.Fatalf("cannot connect to database: %v\n", err)
+	}
+
+	ctx := context.Background()
+	matchRepo := repository.NewMatchRepository(db.DB)
+	redisCache := repository.NewRedisCache(db.Redis)
+
+	// Results saved from here on may miss the scan, or have their scores
+	// overwritten when the rebuilt boards replace the live ones. The margin
+	// covers clock skew between API instances.
+	scanStart := time.Now().Add(-catchUpMargin)
+
+	rebuild := repository.NewLeaderboardRebuild()
+	matches, skipped := 0, 0
+	err = matchRepo.ForEachRankedMatch(ctx, time.Time{}, func(m *models.MatchResult, playedAt time.Time) error {
+		board, err := models.BoardForMatch(m)
+		if err != nil {
+			skipped++
+			return nil
+		}
+		rebuild.Add(board, m.UserID, m.WPM, m.ID, playedAt)
+		matches++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("reading matches failed: %v", err)
+	}
+
+	boards, err := redisCache.ApplyLeaderboardRebuild(ctx, rebuild)
+	if err != nil {
+		log.Fatalf("writing leaderboards failed: %v", err)
+	}
+
+	// Scores only ever go up, so applying a result twice is harmless
+	caughtUp := 0
+	err = matchRepo.ForEachRankedMatch(ctx, scanStart, func(m *models.MatchResult, playedAt time.Time) error {
+		board, err := models.BoardForMatch(m)
+		if err != nil {
+			return nil
+		}
+		caughtUp++
+		return redisCache.UpdateLeaderboard(ctx, board, m.UserID, m.WPM, m.ID, playedAt)
+	})
+	if err != nil {
+		log.Fatalf("catching up on new matches failed: %v", err)
+	}
+
+	log.Printf("rebuilt %d leaderboards from %d matches (%d without a board), then applied %d recent matches again", boards, matches, skipped, caughtUp)
+}
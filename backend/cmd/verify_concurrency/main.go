@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -9,10 +12,29 @@ import (
 )
 
 const (
-	url     = "ws://localhost:8080/ws"
+	apiURL  = "http://localhost:8080"
+	wsURL   = "ws://localhost:8080/ws"
 	clients = 50 // Simulate 50 concurrent clients
 )
 
+// guestToken starts a guest session, since the server only accepts
+// authenticated connections.
+func guestToken() (string, error) {
+	resp, err := http.Post(apiURL+"/api/auth/guest", "application/json", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", err
+	}
+	return session.Token, nil
+}
+
 func main() {
 	var wg sync.WaitGroup
 	wg.Add(clients)
@@ -20,7 +42,12 @@ func main() {
 	for i := 0; i < clients; i++ {
 		go func(id int) {
 			defer wg.Done()
-			c, _, err := websocket.DefaultDialer.Dial(url, nil)
+			token, err := guestToken()
+			if err != nil {
+				log.Printf("Client %d failed to get a session: %v", id, err)
+				return
+			}
+			c, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+url.QueryEscape(token), nil)
 			if err != nil {
 				log.Printf("Client %d failed to connect: %v", id, err)
 				return
@@ -32,7 +59,6 @@ func main() {
 				"type": "join_lobby",
 				"payload": map[string]string{
 					"room_id": "global_arena",
-					"user_id": "test_user",
 				},
 			}
 			if err := c.WriteJSON(joinMsg); err != nil {
@@ -45,7 +71,6 @@ func main() {
 				updateMsg := map[string]interface{}{
 					"type": "typing_update",
 					"payload": map[string]interface{}{
-						"user_id":  "test_user",
 						"wpm":      60 + j,
 						"progress": j * 20,
 					},
@@ -0,0 +1,162 @@
+package achievements
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+const (
+	// XP granted once for each achievement, on top of match XP.
+	AchievementXP = 100
+
+	// Reaching level n takes levelBase * (n-1)^2 XP.
+	levelBase = 100
+)
+
+// rule is an achievement and the condition that unlocks it
+type rule struct {
+	models.Achievement
+	met func(s *models.UserStats) bool
+}
+
+// Rules are evaluated against a user's lifetime stats over verified matches
+// after every verified match.
+var rules = []rule{
+	{models.Achievement{ID: "matches_10", Title: "Warm Up", Description: "Complete 10 matches", Icon: "🔥"},
+		func(s *models.UserStats) bool { return s.TotalMatches >= 10 }},
+	{models.Achievement{ID: "matches_50", Title: "Dedicated", Description: "Complete 50 matches", Icon: "🏃"},
+		func(s *models.UserStats) bool { return s.TotalMatches >= 50 }},
+	{models.Achievement{ID: "matches_100", Title: "Veteran", Description: "Complete 100 matches", Icon: "🎖️"},
+		func(s *models.UserStats) bool { return s.TotalMatches >= 100 }},
+	{models.Achievement{ID: "speed_60", Title: "Speedster", Description: "Reach 60 WPM average", Icon: "⚡"},
+		func(s *models.UserStats) bool { return s.AvgWPM >= 60 }},
+	{models.Achievement{ID: "speed_100", Title: "Sonic", Description: "Reach 100 WPM average", Icon: "🚀"},
+		func(s *models.UserStats) bool { return s.AvgWPM >= 100 }},
+	{models.Achievement{ID: "streak_7", Title: "Habit", Description: "Play on 7 days in a row", Icon: "📅"},
+		func(s *models.UserStats) bool { return s.Streak.Longest >= 7 }},
+	{models.Achievement{ID: "hour_typed", Title: "Marathon", Description: "Type for an hour in total", Icon: "⏱️"},
+		func(s *models.UserStats) bool { return s.TotalTimeSeconds >= 3600 }},
+}
+
+// Level returns the level a total XP reaches, starting at 1
+func Level(xp int64) int {
+	return int(math.Sqrt(float64(max(xp, 0))/levelBase)) + 1
+}
+
+// LevelXP returns the XP at which a level begins
+func LevelXP(level int) int64 {
+	n := int64(level - 1)
+	return levelBase * n * n
+}
+
+// MatchXP is one point per correctly typed word, with at least one point for
+// finishing. Only verified results earn anything.
+func MatchXP(m *models.MatchResult) int64 {
+	if m.Verification != string(anticheat.Verified) {
+		return 0
+	}
+	words := float64(m.WPM) * float64(m.Duration) / 60
+	return max(1, int64(math.Round(words)))
+}
+
+// Unlock is the outcome of recording a match
+type Unlock struct {
+	XP       int64
+	Level    int
+	Unlocked []models.Achievement
+}
+
+// Service awards XP and evaluates achievements as matches are saved
+type Service struct {
+	matchRepo       repository.MatchStore
+	achievementRepo repository.AchievementStore
+}
+
+func NewService(matchRepo repository.MatchStore, achievementRepo repository.AchievementStore) *Service {
+	return &Service{matchRepo: matchRepo, achievementRepo: achievementRepo}
+}
+
+// Record awards XP for a saved match and unlocks any achievements the user
+// now qualifies for. A match that was not verified changes nothing.
+func (s *Service) Record(ctx context.Context, m *models.MatchResult) (*Unlock, error) {
+	if m.Verification != string(anticheat.Verified) {
+		xp, level, err := s.achievementRepo.GetXP(ctx, m.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return &Unlock{XP: xp, Level: level}, nil
+	}
+
+	stats, err := s.matchRepo.GetUserStats(ctx, m.UserID, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var met []string
+	for _, r := range rules {
+		if r.met(stats) {
+			met = append(met, r.ID)
+		}
+	}
+
+	result := &Unlock{}
+	if len(met) > 0 {
+		unlocked, err := s.achievementRepo.Unlock(ctx, m.UserID, m.ID, met)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			if at, ok := unlocked[r.ID]; ok {
+				a := r.Achievement
+				a.UnlockedAt = &at
+				result.Unlocked = append(result.Unlocked, a)
+			}
+		}
+	}
+
+	xp := MatchXP(m) + int64(len(result.Unlocked))*AchievementXP
+	if result.XP, err = s.achievementRepo.AddXP(ctx, m.UserID, xp, Level); err != nil {
+		return nil, err
+	}
+	result.Level = Level(result.XP)
+	return result, nil
+}
+
+// Progress returns a user's XP, level and every achievement, unlocked ones
+// first
+func (s *Service) Progress(ctx context.Context, userID string) (*models.Progress, error) {
+	xp, _, err := s.achievementRepo.GetXP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	unlocked, err := s.achievementRepo.GetUnlocked(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	level := Level(xp)
+	p := &models.Progress{
+		UserID:       userID,
+		XP:           xp,
+		Level:        level,
+		LevelXP:      LevelXP(level),
+		NextLevelXP:  LevelXP(level + 1),
+		Achievements: make([]models.Achievement, 0, len(rules)),
+	}
+	for _, r := range rules {
+		a := r.Achievement
+		if at, ok := unlocked[r.ID]; ok {
+			a.UnlockedAt = &at
+		}
+		p.Achievements = append(p.Achievements, a)
+	}
+	sort.SliceStable(p.Achievements, func(i, j int) bool {
+		return p.Achievements[i].UnlockedAt != nil && p.Achievements[j].UnlockedAt == nil
+	})
+	return p, nil
+}
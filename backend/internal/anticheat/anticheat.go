@@ -0,0 +1,275 @@
+package anticheat
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+)
+
+// Verdict is the outcome of checking a submitted result
+type Verdict string
+
+const (
+	// The keystroke log backs up the claimed result.
+	Verified Verdict = "verified"
+	// The result replays correctly but looks automated. It is kept in the
+	// player's history but never ranked.
+	Flagged Verdict = "flagged"
+	// The result is malformed or does not match its own keystroke log.
+	Rejected Verdict = "rejected"
+	// No keystroke log was submitted, so nothing could be checked.
+	Unverified Verdict = "unverified"
+)
+
+// BackspaceKey is the key name clients use for a deletion
+const BackspaceKey = "Backspace"
+
+const (
+	// No one has sustained this speed on a real keyboard.
+	MaxHumanWPM = 250
+
+	// Intervals shorter than this are key rollover at best; a run of them is
+	// not typing.
+	minHumanInterval = 10 * time.Millisecond
+	maxFastFraction  = 0.2
+
+	// Humans cannot keep their rhythm this even over a long stretch.
+	minRoboticKeys    = 50
+	minIntervalSpread = 5 * time.Millisecond
+
+	// Allowed drift between the client's numbers and the replay, which come
+	// from slightly different clocks.
+	wpmTolerance      = 5
+	wpmRelTolerance   = 0.1
+	accuracyTolerance = 5.0
+
+	// The client counts the test's duration in whole seconds, so its last
+	// keystroke may come up to a second after it.
+	durationTolerance = time.Second
+
+	// Elapsed time is never taken as shorter than this, to avoid a spike on
+	// very short runs. Matches the client's 0.033 minute floor.
+	minElapsed = 2 * time.Second
+
+	maxKeystrokes = 10000
+)
+
+// Keystroke is one entry of a client's keystroke log
+type Keystroke struct {
+	Key  string `json:"k"` // The typed character, or BackspaceKey
+	Time int64  `json:"t"` // Milliseconds since the first keystroke
+}
+
+// Stats are the figures recomputed from a keystroke log
+type Stats struct {
+	WPM         int
+	RawWPM      int
+	Accuracy    float64
+	Consistency float64
+	ErrorCount  int
+	BadKeys     map[string]int // Mistypes by the key that should have been typed
+	Elapsed     time.Duration
+
+	// How often each key and each pair of consecutive keys came up, and how
+	// often the second key of a pair was mistyped, for error rates.
+	KeyCounts    map[string]int
+	BigramCounts map[string]int
+	BadBigrams   map[string]int
+}
+
+// Claim is what the client reported for a result
+type Claim struct {
+	WPM      int
+	Accuracy float64
+	Duration int // Seconds the test ran
+}
+
+// Result is the verdict on a submitted result with the recomputed stats
+type Result struct {
+	Verdict Verdict
+	Reasons []string
+	Stats   Stats
+}
+
+// Check replays the keystroke log against the passage and compares the
+// outcome with the client's claim.
+func Check(spec *passage.Spec, keys []Keystroke, claim Claim) Result {
+	if spec == nil || len(keys) == 0 {
+		return Result{Verdict: Unverified}
+	}
+	if err := spec.Validate(); err != nil {
+		return reject(fmt.Sprintf("invalid passage: %v", err))
+	}
+
+	claimed := time.Duration(claim.Duration) * time.Second
+	stats, err := Replay(spec.Text(), keys, claimed)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if last := time.Duration(keys[len(keys)-1].Time) * time.Millisecond; last > claimed+durationTolerance {
+		return reject(fmt.Sprintf("keystrokes run for %s but the test lasted %ds", last.Round(time.Second), claim.Duration))
+	}
+
+	result := Result{Verdict: Verified, Stats: stats}
+
+	if stats.WPM > MaxHumanWPM {
+		return reject(fmt.Sprintf("%d WPM exceeds the human limit", stats.WPM))
+	}
+	if !withinTolerance(claim.WPM, stats.WPM) {
+		return reject(fmt.Sprintf("claimed %d WPM but keystrokes show %d", claim.WPM, stats.WPM))
+	}
+	if math.Abs(claim.Accuracy-stats.Accuracy) > accuracyTolerance {
+		return reject(fmt.Sprintf("claimed %.0f%% accuracy but keystrokes show %.0f%%", claim.Accuracy, stats.Accuracy))
+	}
+
+	intervals := intervalsOf(keys)
+	if fastFraction(intervals) > maxFastFraction {
+		return reject("inhuman inter-key timing")
+	}
+	if len(intervals) >= minRoboticKeys && stdDev(intervals) < float64(minIntervalSpread) {
+		result.Verdict = Flagged
+		result.Reasons = append(result.Reasons, "robotically even keystroke timing")
+	}
+
+	return result
+}
+
+// Replay reconstructs the typed text from a keystroke log and computes the
+// same figures the client shows. The elapsed time is the later of the last
+// keystroke and atLeast.
+func Replay(text string, keys []Keystroke, atLeast time.Duration) (Stats, error) {
+	if len(keys) > maxKeystrokes {
+		return Stats{}, errors.New("keystroke log too long")
+	}
+
+	expected := []rune(text)
+	typed := make([]rune, 0, len(expected))
+	stats := Stats{
+		BadKeys:      make(map[string]int),
+		KeyCounts:    make(map[string]int),
+		BigramCounts: make(map[string]int),
+		BadBigrams:   make(map[string]int),
+	}
+
+	var last int64
+	for i, k := range keys {
+		if k.Time < last || (i == 0 && k.Time < 0) {
+			return Stats{}, errors.New("keystroke timestamps out of order")
+		}
+		last = k.Time
+
+		if k.Key == BackspaceKey {
+			if len(typed) > 0 {
+				typed = typed[:len(typed)-1]
+			}
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(k.Key)
+		if r == utf8.RuneError || size != len(k.Key) {
+			return Stats{}, fmt.Errorf("invalid key %q", k.Key)
+		}
+		if len(typed) >= len(expected) {
+			return Stats{}, errors.New("typed past the end of the passage")
+		}
+
+		pos := len(typed)
+		want := expected[pos]
+		stats.KeyCounts[string(want)]++
+		var bigram string
+		if pos > 0 {
+			bigram = string(expected[pos-1 : pos+1])
+			stats.BigramCounts[bigram]++
+		}
+
+		if r != want {
+			stats.ErrorCount++
+			stats.BadKeys[string(want)]++
+			if bigram != "" {
+				stats.BadBigrams[bigram]++
+			}
+		}
+		typed = append(typed, r)
+	}
+
+	stats.Elapsed = max(time.Duration(last)*time.Millisecond, atLeast, minElapsed)
+	minutes := stats.Elapsed.Minutes()
+
+	stats.RawWPM = int(math.Round(float64(len(typed)) / 5 / minutes))
+	stats.WPM = int(math.Round(math.Max(0, float64(len(typed)-stats.ErrorCount)) / 5 / minutes))
+
+	stats.Accuracy = 100
+	if len(typed) > 0 {
+		stats.Accuracy = math.Max(0, math.Round(float64(len(typed)-stats.ErrorCount)/float64(len(typed))*100))
+	}
+
+	stats.Consistency = consistency(intervalsOf(keys))
+	return stats, nil
+}
+
+func reject(reason string) Result {
+	return Result{Verdict: Rejected, Reasons: []string{reason}}
+}
+
+func withinTolerance(claimed, actual int) bool {
+	diff := math.Abs(float64(claimed - actual))
+	return diff <= wpmTolerance || diff <= wpmRelTolerance*float64(actual)
+}
+
+func intervalsOf(keys []Keystroke) []float64 {
+	if len(keys) < 2 {
+		return nil
+	}
+	intervals := make([]float64, 0, len(keys)-1)
+	for i := 1; i < len(keys); i++ {
+		intervals = append(intervals, float64(time.Duration(keys[i].Time-keys[i-1].Time)*time.Millisecond))
+	}
+	return intervals
+}
+
+// consistency is 100 minus the coefficient of variation of the inter-key
+// intervals, as a percentage, the same formula the client uses.
+func consistency(intervals []float64) float64 {
+	if len(intervals) < 2 {
+		return 100
+	}
+	m := mean(intervals)
+	if m == 0 {
+		return 100
+	}
+	return math.Max(0, math.Round(100-stdDev(intervals)/m*100))
+}
+
+func fastFraction(intervals []float64) float64 {
+	if len(intervals) == 0 {
+		return 0
+	}
+	n := 0
+	for _, d := range intervals {
+		if d < float64(minHumanInterval) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(intervals))
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+func stdDev(xs []float64) float64 {
+	m := mean(xs)
+	var variance float64
+	for _, x := range xs {
+		variance += (x - m) * (x - m)
+	}
+	return math.Sqrt(variance / float64(len(xs)))
+}
@@ -0,0 +1,154 @@
+package anticheat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+)
+
+var spec = passage.NewSpec(passage.Medium, passage.DefaultWords)
+
+// typing types the first n characters of the passage, waiting interval(i)
+// milliseconds before the i-th keystroke after the first.
+func typing(n int, interval func(i int) int64) []Keystroke {
+	text := []rune(spec.Text())
+	keys := make([]Keystroke, 0, n)
+	var at int64
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			at += interval(i)
+		}
+		keys = append(keys, Keystroke{Key: string(text[i]), Time: at})
+	}
+	return keys
+}
+
+// around varies intervals by spread either side of mean, three steps apart,
+// for a rhythm only as even as spread makes it.
+func around(mean, spread int64) func(int) int64 {
+	return func(i int) int64 { return mean + int64(i%3-1)*spread }
+}
+
+// honest is the claim a client makes for keys typed in a test of seconds.
+func honest(keys []Keystroke, seconds int) Claim {
+	stats, err := Replay(spec.Text(), keys, time.Duration(seconds)*time.Second)
+	if err != nil {
+		panic(err)
+	}
+	return Claim{WPM: stats.WPM, Accuracy: stats.Accuracy, Duration: seconds}
+}
+
+func TestCheck(t *testing.T) {
+	human := typing(60, around(200, 20)) // About 60 WPM over 12s
+	typo := append(typing(59, around(200, 20)), Keystroke{Key: "#", Time: 12000})
+
+	tests := []struct {
+		name    string
+		spec    *passage.Spec
+		keys    []Keystroke
+		claim   Claim
+		verdict Verdict
+		reason  string
+	}{
+		{name: "clean", keys: human, claim: honest(human, 12), verdict: Verified},
+		{name: "typo", keys: typo, claim: honest(typo, 12), verdict: Verified},
+		{name: "no log", claim: Claim{WPM: 60, Accuracy: 100, Duration: 12}, verdict: Unverified},
+		{name: "no passage", spec: &passage.Spec{}, keys: human, claim: honest(human, 12), verdict: Rejected, reason: "invalid passage"},
+
+		// MaxHumanWPM: 2.4 WPM a keystroke over 5 seconds
+		{name: "at the speed limit", keys: typing(104, around(48, 10)), claim: honest(typing(104, around(48, 10)), 5), verdict: Verified},
+		{name: "over the speed limit", keys: typing(105, around(47, 10)), claim: honest(typing(105, around(47, 10)), 5), verdict: Rejected, reason: "exceeds the human limit"},
+
+		// Claimed figures may drift from the replay by 5 WPM or 10%, and 5%
+		// accuracy
+		{name: "wpm within tolerance", keys: human, claim: with(honest(human, 12), func(c *Claim) { c.WPM += 5 }), verdict: Verified},
+		{name: "wpm overstated", keys: human, claim: with(honest(human, 12), func(c *Claim) { c.WPM += 20 }), verdict: Rejected, reason: "claimed"},
+		{name: "wpm understated", keys: human, claim: with(honest(human, 12), func(c *Claim) { c.WPM -= 20 }), verdict: Rejected, reason: "claimed"},
+		{name: "accuracy within tolerance", keys: typo, claim: with(honest(typo, 12), func(c *Claim) { c.Accuracy += 5 }), verdict: Verified},
+		{name: "accuracy overstated", keys: typo, claim: with(honest(typo, 12), func(c *Claim) { c.Accuracy += 6 }), verdict: Rejected, reason: "accuracy"},
+
+		// The claimed duration must cover the log, to the second
+		{name: "log within a second of the duration", keys: human, claim: with(honest(human, 12), func(c *Claim) { c.Duration = 11 }), verdict: Verified},
+		{name: "log longer than the duration", keys: human, claim: with(honest(human, 12), func(c *Claim) { c.Duration = 10 }), verdict: Rejected, reason: "test lasted"},
+
+		// Up to a fifth of intervals may be under 10ms
+		{name: "a fifth of intervals fast", keys: typing(51, fastEvery(5)), claim: honest(typing(51, fastEvery(5)), 9), verdict: Verified},
+		{name: "over a fifth of intervals fast", keys: typing(51, fastEvery(4)), claim: honest(typing(51, fastEvery(4)), 8), verdict: Rejected, reason: "inhuman inter-key timing"},
+
+		// 50 or more intervals with a spread under 5ms look automated
+		{name: "even rhythm over a short run", keys: typing(50, around(200, 0)), claim: honest(typing(50, around(200, 0)), 10), verdict: Verified},
+		{name: "even rhythm", keys: typing(51, around(200, 0)), claim: honest(typing(51, around(200, 0)), 10), verdict: Flagged, reason: "robotically even"},
+		{name: "spread just under 5ms", keys: typing(51, alternating(196, 204)), claim: honest(typing(51, alternating(196, 204)), 10), verdict: Flagged, reason: "robotically even"},
+		{name: "spread of 5ms", keys: typing(51, alternating(195, 205)), claim: honest(typing(51, alternating(195, 205)), 10), verdict: Verified},
+
+		// Logs that cannot be replayed
+		{name: "out of order", keys: []Keystroke{{Key: "a", Time: 100}, {Key: "b", Time: 50}}, claim: Claim{Duration: 1}, verdict: Rejected, reason: "out of order"},
+		{name: "invalid key", keys: []Keystroke{{Key: "ab", Time: 0}}, claim: Claim{Duration: 1}, verdict: Rejected, reason: "invalid key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &spec
+			if tt.spec != nil {
+				s = tt.spec
+			}
+			result := Check(s, tt.keys, tt.claim)
+			if result.Verdict != tt.verdict {
+				t.Fatalf("verdict %s %v, want %s", result.Verdict, result.Reasons, tt.verdict)
+			}
+			if reasons := strings.Join(result.Reasons, "; "); !strings.Contains(reasons, tt.reason) {
+				t.Fatalf("reasons %q, want one mentioning %q", reasons, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReplayPastTheEnd(t *testing.T) {
+	text := spec.Text()
+	keys := typing(len([]rune(text)), around(200, 20))
+	keys = append(keys, Keystroke{Key: "x", Time: keys[len(keys)-1].Time + 200})
+	if _, err := Replay(text, keys, 0); err == nil || !strings.Contains(err.Error(), "past the end") {
+		t.Fatalf("got %v, want an error for typing past the end", err)
+	}
+}
+
+func TestReplayBackspace(t *testing.T) {
+	// "ab" typed as "ax", corrected
+	keys := []Keystroke{{Key: "a", Time: 0}, {Key: "x", Time: 200}, {Key: BackspaceKey, Time: 400}, {Key: "b", Time: 600}}
+	stats, err := Replay("ab", keys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ErrorCount != 1 || stats.BadKeys["b"] != 1 || stats.BadBigrams["ab"] != 1 {
+		t.Fatalf("errors %d, bad keys %v, bad bigrams %v; want the x counted against b", stats.ErrorCount, stats.BadKeys, stats.BadBigrams)
+	}
+	if stats.Elapsed != minElapsed {
+		t.Fatalf("elapsed %s, want the %s floor", stats.Elapsed, minElapsed)
+	}
+}
+
+func with(c Claim, change func(*Claim)) Claim {
+	change(&c)
+	return c
+}
+
+// fastEvery makes every n-th interval 5ms and the rest 200ms, give or take.
+func fastEvery(n int) func(int) int64 {
+	return func(i int) int64 {
+		if i%n == 0 {
+			return 5
+		}
+		return around(200, 20)(i)
+	}
+}
+
+func alternating(a, b int64) func(int) int64 {
+	return func(i int) int64 {
+		if i%2 == 0 {
+			return a
+		}
+		return b
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// ErrInvalidToken is returned for a token that is malformed, forged, expired
+// or logged out.
+var ErrInvalidToken = errors.New("invalid session token")
+
+// Claims identify the session a token was issued for
+type Claims struct {
+	UserID    string `json:"uid"`
+	SessionID string `json:"sid"`
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+}
+
+// Sessions issues and verifies signed session tokens. A token is
+// base64(claims) "." base64(HMAC-SHA256(claims)); the session it names must
+// also still exist in Redis, so logging out revokes it immediately.
+type Sessions struct {
+	secret []byte
+	ttl    time.Duration
+	cache  repository.SessionStore
+}
+
+// NewSessions signs tokens with the configured secret. Without one a random
+// secret is used, and sessions do not survive a restart or work across
+// instances.
+func NewSessions(cache repository.SessionStore, cfg config.Session) *Sessions {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		log.Println("SESSION_SECRET is not set, using a random secret")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Sessions{secret: secret, ttl: cfg.TTL, cache: cache}
+}
+
+// Issue starts a new session for userID and returns its token
+func (s *Sessions) Issue(ctx context.Context, userID string) (string, Claims, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	claims := Claims{
+		UserID:    userID,
+		SessionID: hex.EncodeToString(id),
+		ExpiresAt: time.Now().Add(s.ttl).Unix(),
+	}
+	if err := s.cache.CreateSession(ctx, claims.SessionID, userID, s.ttl); err != nil {
+		return "", Claims{}, err
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + s.sign(encoded), claims, nil
+}
+
+// Verify checks a token's signature and expiry and that its session has not
+// been revoked.
+func (s *Sessions) Verify(ctx context.Context, token string) (Claims, error) {
+	claims, err := s.parse(token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	userID, err := s.cache.GetSession(ctx, claims.SessionID)
+	if err != nil || userID != claims.UserID {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Revoke ends the session a token belongs to
+func (s *Sessions) Revoke(ctx context.Context, token string) error {
+	claims, err := s.parse(token)
+	if err != nil {
+		return err
+	}
+	return s.cache.DeleteSession(ctx, claims.SessionID)
+}
+
+func (s *Sessions) parse(token string) (Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(encoded))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if claims.UserID == "" || claims.SessionID == "" || time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *Sessions) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header
+func BearerToken(header string) string {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Identity is the authenticated user behind a connection
+type Identity struct {
+	UserID   string
+	Username string
+}
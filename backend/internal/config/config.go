@@ -0,0 +1,201 @@
+// Package config loads the backend's settings. Each setting has a default
+// and can be set, in increasing order of precedence, from a JSON file, an
+// environment variable or a command-line flag.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/origin"
+)
+
+// Config holds every setting of the backend
+type Config struct {
+	Server     Server     `key:"server"`
+	Postgres   Postgres   `key:"postgres"`
+	Redis      Redis      `key:"redis"`
+	WebSocket  WebSocket  `key:"websocket"`
+	Session    Session    `key:"session"`
+	Migrations Migrations `key:"migrations"`
+}
+
+// Server configures the HTTP listener
+type Server struct {
+	Env             string        `key:"env" env:"APP_ENV" usage:"development or production; production refuses settings only fit for one instance on localhost"`
+	Port            int           `key:"port" env:"PORT" usage:"HTTP port"`
+	ReadTimeout     time.Duration `key:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"maximum time to read a request"`
+	WriteTimeout    time.Duration `key:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"maximum time to write a response"`
+	IdleTimeout     time.Duration `key:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"how long idle keep-alive connections are kept"`
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" usage:"how long to wait for requests to finish on shutdown"`
+	AllowedOrigins  []string      `key:"allowed_origins" env:"ALLOWED_ORIGINS" usage:"comma-separated origins allowed to call the API and open WebSockets, such as https://*.example.com or http://localhost:*, or * for any; the backend's own origin is always allowed"`
+
+	AllowCredentials bool `key:"allow_credentials" env:"ALLOW_CREDENTIALS" usage:"let allowed origins send cookies and other credentials"`
+}
+
+// Postgres configures the database connection pool
+type Postgres struct {
+	Host           string        `key:"host" env:"DB_HOST" usage:"PostgreSQL host"`
+	Port           int           `key:"port" env:"DB_PORT" usage:"PostgreSQL port"`
+	User           string        `key:"user" env:"DB_USER" usage:"PostgreSQL user"`
+	Password       string        `key:"password" env:"DB_PASSWORD" usage:"PostgreSQL password"`
+	Name           string        `key:"name" env:"DB_NAME" usage:"PostgreSQL database name"`
+	SSLMode        string        `key:"sslmode" env:"DB_SSLMODE" usage:"disable, allow, prefer, require, verify-ca or verify-full"`
+	MaxConns       int           `key:"max_conns" env:"DB_MAX_CONNS" usage:"maximum pooled connections"`
+	MinConns       int           `key:"min_conns" env:"DB_MIN_CONNS" usage:"connections kept open when idle"`
+	ConnectTimeout time.Duration `key:"connect_timeout" env:"DB_CONNECT_TIMEOUT" usage:"time allowed to connect at startup"`
+}
+
+// Redis configures the Redis client
+type Redis struct {
+	Addr        string        `key:"addr" env:"REDIS_ADDR" usage:"Redis host:port"`
+	Password    string        `key:"password" env:"REDIS_PASSWORD" usage:"Redis password"`
+	DB          int           `key:"db" env:"REDIS_DB" usage:"Redis database number"`
+	TLS         bool          `key:"tls" env:"REDIS_TLS" usage:"connect to Redis over TLS"`
+	PoolSize    int           `key:"pool_size" env:"REDIS_POOL_SIZE" usage:"maximum pooled connections, 0 for the client default"`
+	DialTimeout time.Duration `key:"dial_timeout" env:"REDIS_DIAL_TIMEOUT" usage:"time allowed to connect at startup"`
+}
+
+// WebSocket limits each game connection
+type WebSocket struct {
+	MaxMessageSize  int64         `key:"max_message_size" env:"WS_MAX_MESSAGE_SIZE" usage:"largest message accepted from a client, in bytes"`
+	WriteWait       time.Duration `key:"write_wait" env:"WS_WRITE_WAIT" usage:"time allowed to write a message to a client"`
+	PongWait        time.Duration `key:"pong_wait" env:"WS_PONG_WAIT" usage:"time allowed for a client to answer a ping"`
+	PingPeriod      time.Duration `key:"ping_period" env:"WS_PING_PERIOD" usage:"how often clients are pinged; must be less than pong_wait"`
+	SendBuffer      int           `key:"send_buffer" env:"WS_SEND_BUFFER" usage:"messages queued for a slow client before it is dropped"`
+	ReadBufferSize  int           `key:"read_buffer_size" env:"WS_READ_BUFFER_SIZE" usage:"I/O read buffer, in bytes"`
+	WriteBufferSize int           `key:"write_buffer_size" env:"WS_WRITE_BUFFER_SIZE" usage:"I/O write buffer, in bytes"`
+	HandshakeWait   time.Duration `key:"handshake_wait" env:"WS_HANDSHAKE_WAIT" usage:"time allowed for a client's hello after connecting"`
+	ResumeWindow    time.Duration `key:"resume_window" env:"WS_RESUME_WINDOW" usage:"how long a dropped client keeps its room and race place and may reconnect to resume"`
+	ReplayBuffer    int           `key:"replay_buffer" env:"WS_REPLAY_BUFFER" usage:"recent events kept per client to replay on resume; less than send_buffer"`
+}
+
+// Session configures login sessions
+type Session struct {
+	Secret string        `key:"secret" env:"SESSION_SECRET" usage:"key that signs session tokens, shared by every instance; random when unset, which production refuses"`
+	TTL    time.Duration `key:"ttl" env:"SESSION_TTL" usage:"how long a session lasts"`
+}
+
+// Migrations configures schema migration at startup
+type Migrations struct {
+	Auto    bool          `key:"auto" env:"AUTO_MIGRATE" usage:"apply pending migrations at startup"`
+	Timeout time.Duration `key:"timeout" env:"MIGRATE_TIMEOUT" usage:"time allowed for migrations at startup"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Env:             "development",
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownTimeout: 5 * time.Second,
+			AllowedOrigins:  []string{"http://localhost:5173", "http://127.0.0.1:5173"}, // Vite dev server
+		},
+		Postgres: Postgres{
+			Host:           "localhost",
+			Port:           5432,
+			SSLMode:        "require", // Supabase requires SSL
+			MaxConns:       10,
+			ConnectTimeout: 5 * time.Second,
+		},
+		Redis: Redis{
+			Addr:        "localhost:6379",
+			TLS:         true, // Upstash requires TLS
+			DialTimeout: 5 * time.Second,
+		},
+		WebSocket: WebSocket{
+			// A game_end carries the full keystroke log, so this has to fit
+			// a few thousand keystrokes.
+			MaxMessageSize:  128 * 1024,
+			WriteWait:       10 * time.Second,
+			PongWait:        60 * time.Second,
+			PingPeriod:      54 * time.Second,
+			SendBuffer:      256,
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			HandshakeWait:   10 * time.Second,
+			ResumeWindow:    30 * time.Second,
+			ReplayBuffer:    128,
+		},
+		Session: Session{
+			TTL: 30 * 24 * time.Hour,
+		},
+		Migrations: Migrations{
+			Auto:    true,
+			Timeout: 2 * time.Minute,
+		},
+	}
+}
+
+var envs = map[string]bool{"development": true, "production": true}
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+// Validate reports every setting that is out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(envs[c.Server.Env], "server.env %q is not one of development, production", c.Server.Env)
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	if policy, err := origin.NewPolicy(c.Server.AllowedOrigins); err != nil {
+		errs = append(errs, fmt.Errorf("server.allowed_origins:\n%w", err))
+	} else {
+		// Left at the development defaults, the site's own pages would be
+		// refused unless served from the backend's host
+		check(!policy.LocalOnly() || c.Server.Env != "production",
+			"server.allowed_origins only allows localhost; list the site's origins when server.env is production")
+	}
+	check(!c.Server.AllowCredentials || !slices.Contains(c.Server.AllowedOrigins, "*"),
+		"server.allowed_origins cannot be * when server.allow_credentials is set")
+
+	check(c.Postgres.Host != "", "postgres.host is required")
+	check(c.Postgres.Port > 0 && c.Postgres.Port < 65536, "postgres.port must be between 1 and 65535, got %d", c.Postgres.Port)
+	check(c.Postgres.User != "", "postgres.user is required")
+	check(c.Postgres.Name != "", "postgres.name is required")
+	check(sslModes[c.Postgres.SSLMode], "postgres.sslmode %q is not one of disable, allow, prefer, require, verify-ca, verify-full", c.Postgres.SSLMode)
+	check(c.Postgres.MaxConns > 0, "postgres.max_conns must be positive")
+	check(c.Postgres.MinConns >= 0 && c.Postgres.MinConns <= c.Postgres.MaxConns, "postgres.min_conns must be between 0 and postgres.max_conns")
+	check(c.Postgres.ConnectTimeout > 0, "postgres.connect_timeout must be positive")
+
+	check(c.Redis.Addr != "", "redis.addr is required")
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+	check(c.Redis.PoolSize >= 0, "redis.pool_size must not be negative")
+	check(c.Redis.DialTimeout > 0, "redis.dial_timeout must be positive")
+
+	check(c.WebSocket.MaxMessageSize > 0, "websocket.max_message_size must be positive")
+	check(c.WebSocket.WriteWait > 0, "websocket.write_wait must be positive")
+	check(c.WebSocket.PongWait > 0, "websocket.pong_wait must be positive")
+	check(c.WebSocket.PingPeriod > 0 && c.WebSocket.PingPeriod < c.WebSocket.PongWait,
+		"websocket.ping_period must be positive and less than websocket.pong_wait")
+	check(c.WebSocket.SendBuffer > 0, "websocket.send_buffer must be positive")
+	check(c.WebSocket.ReadBufferSize > 0, "websocket.read_buffer_size must be positive")
+	check(c.WebSocket.WriteBufferSize > 0, "websocket.write_buffer_size must be positive")
+	check(c.WebSocket.HandshakeWait > 0, "websocket.handshake_wait must be positive")
+	check(c.WebSocket.ResumeWindow > 0, "websocket.resume_window must be positive")
+	check(c.WebSocket.ReplayBuffer > 0 && c.WebSocket.ReplayBuffer < c.WebSocket.SendBuffer,
+		"websocket.replay_buffer must be positive and less than websocket.send_buffer")
+
+	// Every instance has to verify tokens signed by the others
+	check(c.Session.Secret != "" || c.Server.Env != "production", "session.secret is required when server.env is production")
+	check(c.Session.TTL > 0, "session.ttl must be positive")
+	check(c.Migrations.Timeout > 0, "migrations.timeout must be positive")
+
+	return errors.Join(errs...)
+}
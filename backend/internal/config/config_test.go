@@ -0,0 +1,118 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid is the default configuration with the settings that have no default
+func valid() *Config {
+	c := Default()
+	c.Postgres.User = "typemaster"
+	c.Postgres.Name = "typemaster"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		errs   []string
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{
+			name:   "no database",
+			change: func(c *Config) { c.Postgres.User, c.Postgres.Name = "", "" },
+			errs:   []string{"postgres.user is required", "postgres.name is required"},
+		},
+		{
+			name:   "unknown env",
+			change: func(c *Config) { c.Server.Env = "staging" },
+			errs:   []string{`server.env "staging"`},
+		},
+		{
+			name:   "ping after pong",
+			change: func(c *Config) { c.WebSocket.PingPeriod = c.WebSocket.PongWait },
+			errs:   []string{"websocket.ping_period"},
+		},
+		{
+			name:   "replay buffer as large as the send buffer",
+			change: func(c *Config) { c.WebSocket.ReplayBuffer = c.WebSocket.SendBuffer },
+			errs:   []string{"websocket.replay_buffer"},
+		},
+		{
+			name: "production with only localhost origins",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Session.Secret = "secret"
+			},
+			errs: []string{"server.allowed_origins only allows localhost"},
+		},
+		{
+			name: "bad origins",
+			change: func(c *Config) {
+				c.Server.AllowedOrigins = []string{"typemaster.app", "https://typemaster.app/"}
+			},
+			errs: []string{"server.allowed_origins:", "must start with http://", "no path"},
+		},
+		{
+			name: "any origin with credentials",
+			change: func(c *Config) {
+				c.Server.AllowedOrigins = []string{"*"}
+				c.Server.AllowCredentials = true
+			},
+			errs: []string{"cannot be * when server.allow_credentials is set"},
+		},
+		{
+			name: "production without a session secret",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Server.AllowedOrigins = []string{"https://typemaster.app"}
+			},
+			errs: []string{"session.secret is required"},
+		},
+		{
+			name: "production",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Server.AllowedOrigins = []string{"https://typemaster.app"}
+				c.Session.Secret = "secret"
+			},
+		},
+		{
+			name: "every error at once",
+			change: func(c *Config) {
+				c.Server.Port = 0
+				c.Redis.Addr = ""
+				c.Session.TTL = -time.Hour
+			},
+			errs: []string{"server.port", "redis.addr is required", "session.ttl must be positive"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(c)
+			err := c.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("valid, want errors mentioning %q", tt.errs)
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.errs) {
+				t.Fatalf("%d errors, want %d:\n%v", got, len(tt.errs), err)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("errors do not mention %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// setting is one leaf of Config, addressed as section.key
+type setting struct {
+	key   string
+	env   string
+	usage string
+	value reflect.Value
+}
+
+func settings(c *Config) []setting {
+	var list []setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Type().Field(i).Tag.Get("key")
+		fields := sections.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			tag := fields.Type().Field(j).Tag
+			list = append(list, setting{
+				key:   section + "." + tag.Get("key"),
+				env:   tag.Get("env"),
+				usage: tag.Get("usage"),
+				value: fields.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (s setting) set(raw string) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration such as 10s or 5m", s.key, raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a whole number", s.key, raw)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", s.key, raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", s.key, v.Type())
+	}
+	return nil
+}
+
+func (s setting) String() string {
+	switch v := s.value.Interface().(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case string:
+		if strings.Contains(s.key, "password") || strings.Contains(s.key, "secret") {
+			return ""
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Load builds the configuration from defaults, then the JSON file named by
+// -config or CONFIG_FILE, then environment variables (including any in a .env
+// file), then flags, and validates it. Empty variables count as unset. Flags are named after their setting, as in -server.port.
+// It returns the arguments left after the flags.
+func Load(name string, args []string) (*Config, []string, error) {
+	c := Default()
+	list := settings(c)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "JSON config `file`")
+	flags := make(map[string]*string, len(list))
+	for _, s := range list {
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		flags[s.key] = fs.String(s.key, s.String(), usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(list, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range list {
+		if raw := os.Getenv(s.env); raw != "" && s.env != "" {
+			if err := s.set(raw); err != nil {
+				return nil, nil, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		for _, s := range list {
+			if s.key == f.Name {
+				if setErr := s.set(*flags[s.key]); setErr != nil {
+					err = fmt.Errorf("flag -%s: %w", f.Name, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return c, fs.Args(), nil
+}
+
+// loadFile applies a JSON file of sections, such as
+// {"server": {"port": 8080}, "redis": {"addr": "redis:6379"}}
+func loadFile(list []setting, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	var file map[string]map[string]any
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(list))
+	for _, s := range list {
+		byKey[s.key] = s
+	}
+
+	// Sorted so that the first error reported does not vary between runs
+	var keys []string
+	values := make(map[string]any)
+	for section, fields := range file {
+		for field, v := range fields {
+			key := section + "." + field
+			keys = append(keys, key)
+			values[key] = v
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown setting %s", path, key)
+		}
+		var raw string
+		switch v := values[key].(type) {
+		case string:
+			raw = v
+		case float64:
+			raw = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			raw = strconv.FormatBool(v)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			raw = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("config file %s: %s has an unsupported value", path, key)
+		}
+		if err := s.set(raw); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	return nil
+}
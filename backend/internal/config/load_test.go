@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads, so that the machine running the
+// tests cannot change their outcome. Empty variables count as unset.
+func clearEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	for _, s := range settings(Default()) {
+		if s.env != "" {
+			t.Setenv(s.env, "")
+		}
+	}
+}
+
+func writeFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	file := writeFile(t, `{
+		"server": {"port": 9000, "write_timeout": "45s", "allowed_origins": ["https://a.example", "https://b.example"]},
+		"postgres": {"user": "file", "name": "typemaster"},
+		"redis": {"addr": "file:6379", "tls": false}
+	}`)
+	t.Setenv("PORT", "9100")
+	t.Setenv("REDIS_ADDR", "env:6379")
+	t.Setenv("DB_USER", "env")
+
+	c, args, err := Load("api", []string{"-config", file, "-server.port", "9200", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		setting   string
+		got, want any
+	}{
+		{"default", c.Server.ReadTimeout, 10 * time.Second},
+		{"file over default", c.Server.WriteTimeout, 45 * time.Second},
+		{"file list", strings.Join(c.Server.AllowedOrigins, " "), "https://a.example https://b.example"},
+		{"file bool", c.Redis.TLS, false},
+		{"file", c.Postgres.Name, "typemaster"},
+		{"env over file", c.Postgres.User, "env"},
+		{"env over file", c.Redis.Addr, "env:6379"},
+		{"flag over env", c.Server.Port, 9200},
+	}
+	for _, check := range checks {
+		if check.got != check.want {
+			t.Errorf("%s: got %v, want %v", check.setting, check.got, check.want)
+		}
+	}
+	if len(args) != 2 || args[0] != "migrate" || args[1] != "up" {
+		t.Errorf("args %q, want the ones after the flags", args)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, `{"postgres": {"user": "file", "name": "typemaster"}}`))
+
+	c, _, err := Load("api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Postgres.User != "file" {
+		t.Fatalf("postgres.user %q, want it read from CONFIG_FILE", c.Postgres.User)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		err  string
+	}{
+		{name: "unknown file setting", file: `{"server": {"prot": 80}}`, err: "unknown setting server.prot"},
+		{name: "malformed file", file: `{"server": `, err: "config file"},
+		{name: "file value of the wrong type", file: `{"server": {"read_timeout": "soon"}}`, err: "not a duration"},
+		{name: "env value of the wrong type", env: map[string]string{"PORT": "eighty"}, err: "env PORT: server.port"},
+		{name: "flag value of the wrong type", args: []string{"-redis.tls", "maybe"}, err: "flag -redis.tls"},
+		{name: "missing file", args: []string{"-config", "/nonexistent/config.json"}, err: "reading config file"},
+		{name: "invalid", env: map[string]string{"DB_MAX_CONNS": "0"}, err: "postgres.max_conns must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("DB_USER", "typemaster")
+			t.Setenv("DB_NAME", "typemaster")
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, tt.file))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, _, err := Load("api", tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
-	"os"
-	"time"
+	"net"
+	"net/url"
+	"strconv"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -18,14 +19,15 @@ type Service struct {
 	Redis *redis.Client
 }
 
-func New() (*Service, error) {
-	db, err := connectToPostgres()
+func New(cfg *config.Config) (*Service, error) {
+	db, err := connectToPostgres(cfg.Postgres)
 	if err != nil {
 		return nil, err
 	}
 
-	rdb, err := connectToRedis()
+	rdb, err := connectToRedis(cfg.Redis)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -35,64 +37,70 @@ func New() (*Service, error) {
 	}, nil
 }
 
-func connectToPostgres() (*pgxpool.Pool, error) {
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+// NewPostgres connects to PostgreSQL alone, for tools that do not need Redis
+func NewPostgres(cfg config.Postgres) (*pgxpool.Pool, error) {
+	return connectToPostgres(cfg)
+}
 
-	// Supabase requires SSL
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=require", dbUser, dbPassword, dbHost, dbPort, dbName)
+func connectToPostgres(cfg config.Postgres) (*pgxpool.Pool, error) {
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
-	config, err := pgxpool.ParseConfig(connStr)
+	poolConfig, err := pgxpool.ParseConfig(connURL.String())
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse database config: %v", err)
 	}
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
 
 	// Force IPv4 removed - we will use Connection Pooler (port 6543) instead
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %v", err)
 	}
 
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("unable to connect to database: %v", err)
 	}
 
-	log.Println("Connected to PostgreSQL")
+	log.Printf("Connected to PostgreSQL (sslmode=%s)", cfg.SSLMode)
 	return pool, nil
 }
 
-func connectToRedis() (*redis.Client, error) {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
+func connectToRedis(cfg config.Redis) (*redis.Client, error) {
+	opts := &redis.Options{
+		Addr:        cfg.Addr,
+		Password:    cfg.Password,
+		DB:          cfg.DB,
+		PoolSize:    cfg.PoolSize,
+		DialTimeout: cfg.DialTimeout,
 	}
-
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-		// Upstash requires TLS
-		TLSConfig: &tls.Config{
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{
 			MinVersion: tls.VersionTLS12,
-		},
-	})
+		}
+	}
+	rdb := redis.NewClient(opts)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("unable to connect to redis: %v", err)
 	}
 
-	log.Println("Connected to Redis")
+	log.Printf("Connected to Redis (tls=%t)", cfg.TLS)
 	return rdb, nil
 }
 
@@ -0,0 +1,166 @@
+package game
+
+import (
+	"sync"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// Manager owns the race for every active room. Race state is saved to a
+// RaceStore as it changes, and a room's race is restored from it when the
+// room is next used, whether after a restart or on another instance.
+type Manager struct {
+	mu        sync.Mutex
+	races     map[string]*Race
+	broadcast BroadcastFunc
+	persist   *persister
+}
+
+func NewManager(broadcast BroadcastFunc, store RaceStore) *Manager {
+	return &Manager{
+		races:     make(map[string]*Race),
+		broadcast: broadcast,
+		persist:   newPersister(store),
+	}
+}
+
+// Race returns the race for a room, or nil if the room has no members.
+func (m *Manager) Race(roomID string) *Race {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.races[roomID]
+}
+
+// Rooms returns the IDs of every room with an active race.
+func (m *Manager) Rooms() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rooms := make([]string, 0, len(m.races))
+	for roomID := range m.races {
+		rooms = append(rooms, roomID)
+	}
+	return rooms
+}
+
+// RaceTest returns the test a user is taking in a room's race, if they
+// are in the race under way. A race run on another instance is read from its saved
+// state.
+func (m *Manager) RaceTest(roomID, userID string) (models.IssuedTest, bool) {
+	race := m.Race(roomID)
+	if race == nil {
+		snap := m.persist.load(roomID)
+		if snap == nil {
+			return models.IssuedTest{}, false
+		}
+		// Only read, so its timers are never armed
+		race = restoreRace(snap, m.broadcast, nil)
+	}
+	return race.testFor(userID)
+}
+
+// open returns a room's race, restoring it from saved state or creating it if
+// needed.
+func (m *Manager) open(roomID string) *Race {
+	if race := m.Race(roomID); race != nil {
+		return race
+	}
+
+	var race *Race
+	if snap := m.persist.load(roomID); snap != nil {
+		race = restoreRace(snap, m.broadcast, m.persist)
+	} else {
+		race = newRace(roomID, m.broadcast, m.persist)
+	}
+
+	m.mu.Lock()
+	if existing, ok := m.races[roomID]; ok {
+		m.mu.Unlock()
+		return existing
+	}
+	m.races[roomID] = race
+	m.mu.Unlock()
+
+	race.resume()
+	return race
+}
+
+// Join adds a user to a room's race, creating the race if needed. Users who
+// join after a race has started watch it and take part in the next one; users
+// rejoining a race they were in pick up where they left off.
+func (m *Manager) Join(roomID, userID, username string) {
+	m.open(roomID).join(userID, username)
+}
+
+// Adopt takes over a room whose race was run elsewhere, restoring its saved
+// state and reconciling it with members, the room's current members keyed by
+// user ID.
+func (m *Manager) Adopt(roomID string, members map[string]string) {
+	race := m.open(roomID)
+	race.sync(members)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.races[roomID] == race && race.empty() {
+		race.close()
+		delete(m.races, roomID)
+		m.persist.remove(roomID)
+	}
+}
+
+// Discard stops and forgets a room's race without touching its saved state,
+// for when another instance has taken the room over. It reports whether there
+// was a race to discard.
+func (m *Manager) Discard(roomID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	race, ok := m.races[roomID]
+	if !ok {
+		return false
+	}
+	race.close()
+	delete(m.races, roomID)
+	m.persist.forget(roomID)
+	return true
+}
+
+// Leave removes a user from a room's race, discarding the race once the room
+// is empty.
+func (m *Manager) Leave(roomID, userID string) {
+	race := m.Race(roomID)
+	if race == nil || !race.leave(userID) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.races[roomID] == race && race.empty() {
+		delete(m.races, roomID)
+		m.persist.remove(roomID)
+	}
+}
+
+// Ready marks a user as ready. The countdown starts once everyone in the room
+// is ready; readying up after a race has finished starts a new round.
+func (m *Manager) Ready(roomID, userID string) {
+	if race := m.Race(roomID); race != nil {
+		race.ready(userID)
+	}
+}
+
+// Progress records a racer's latest position in the passage.
+func (m *Manager) Progress(roomID, userID string, progress, wpm int) {
+	if race := m.Race(roomID); race != nil {
+		race.progress(userID, progress, wpm)
+	}
+}
+
+// Finish records a racer's final result, ending the race once every racer
+// has finished. A result that is not ranked still finishes the racer but is
+// left out of the ranking.
+func (m *Manager) Finish(roomID, userID string, wpm int, accuracy float64, ranked bool) {
+	if race := m.Race(roomID); race != nil {
+		race.finish(userID, wpm, accuracy, ranked)
+	}
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+const (
+	// How long a room's saved race outlives its last change. Long enough to
+	// cover a full race and a redeploy; idle rooms simply expire.
+	StateTTL = 10 * time.Minute
+
+	storeTimeout = 2 * time.Second
+)
+
+// RaceStore keeps each room's race state where any instance can pick it up.
+// GetRace returns nil for a room with no saved race.
+type RaceStore interface {
+	SaveRace(ctx context.Context, race *models.RaceSnapshot, ttl time.Duration) error
+	GetRace(ctx context.Context, roomID string) (*models.RaceSnapshot, error)
+	DeleteRace(ctx context.Context, roomID string) error
+}
+
+// persister writes race state to the store in the background. Only the
+// latest state of each room is kept between writes, so a burst of progress
+// updates costs one write.
+type persister struct {
+	store RaceStore
+
+	mu      sync.Mutex
+	pending map[string]*models.RaceSnapshot // nil deletes the room's state
+	writing map[string]*models.RaceSnapshot // Taken from pending, not yet written
+	wake    chan struct{}
+}
+
+func newPersister(store RaceStore) *persister {
+	p := &persister{
+		store:   store,
+		pending: make(map[string]*models.RaceSnapshot),
+		writing: make(map[string]*models.RaceSnapshot),
+		wake:    make(chan struct{}, 1),
+	}
+	go p.run()
+	return p
+}
+
+func (p *persister) save(snap *models.RaceSnapshot) {
+	p.queue(snap.RoomID, snap)
+}
+
+func (p *persister) remove(roomID string) {
+	p.queue(roomID, nil)
+}
+
+// forget drops a room's unwritten state, leaving what the store holds.
+func (p *persister) forget(roomID string) {
+	p.mu.Lock()
+	delete(p.pending, roomID)
+	p.mu.Unlock()
+}
+
+func (p *persister) queue(roomID string, snap *models.RaceSnapshot) {
+	p.mu.Lock()
+	p.pending[roomID] = snap
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *persister) run() {
+	for range p.wake {
+		p.mu.Lock()
+		pending := p.pending
+		p.pending = make(map[string]*models.RaceSnapshot)
+		for roomID, snap := range pending {
+			p.writing[roomID] = snap
+		}
+		p.mu.Unlock()
+
+		for roomID, snap := range pending {
+			ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+			var err error
+			if snap == nil {
+				err = p.store.DeleteRace(ctx, roomID)
+			} else {
+				err = p.store.SaveRace(ctx, snap, StateTTL)
+			}
+			cancel()
+			if err != nil {
+				log.Printf("Error saving race state for room %s: %v", roomID, err)
+			}
+
+			p.mu.Lock()
+			delete(p.writing, roomID)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// load returns a room's saved race state, or nil if it has none. State still
+// waiting to be written, or being written, wins over what the store holds.
+func (p *persister) load(roomID string) *models.RaceSnapshot {
+	p.mu.Lock()
+	snap, ok := p.pending[roomID]
+	if !ok {
+		snap, ok = p.writing[roomID]
+	}
+	p.mu.Unlock()
+	if ok {
+		return snap
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	snap, err := p.store.GetRace(ctx, roomID)
+	if err != nil {
+		log.Printf("Error loading race state for room %s: %v", roomID, err)
+		return nil
+	}
+	return snap
+}
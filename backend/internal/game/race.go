@@ -0,0 +1,566 @@
+package game
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+)
+
+// State is a stage in a race's lifecycle
+type State string
+
+const (
+	StateWaiting   State = "waiting"
+	StateCountdown State = "countdown"
+	StateRunning   State = "running"
+	StateFinished  State = "finished"
+)
+
+const (
+	// Time between everyone being ready and the race starting.
+	CountdownDuration = 5 * time.Second
+
+	// Maximum time a race may run before it is finished for everyone.
+	DefaultTimeLimit = 60 * time.Second
+)
+
+// BroadcastFunc delivers an encoded event to every member of a room.
+type BroadcastFunc func(roomID string, data []byte)
+
+// Participant is a member of a room and their progress in the current race.
+type Participant struct {
+	UserID     string
+	Username   string
+	Ready      bool
+	Racing     bool // Took part in the current race from its start
+	Finished   bool
+	WPM        int
+	Accuracy   float64
+	Progress   int
+	FinishedAt time.Time
+	Unranked   bool // Finished with a result that was not verified
+}
+
+// Race is the server-side state machine for a single room:
+// waiting -> countdown -> running -> finished. Transitions driven by timers
+// are guarded by round so that a stale timer can never affect a later race.
+//
+// Events are queued while mu is held and broadcast once it is released, so
+// that a slow broadcast never holds up the race. sendMu keeps them in order.
+type Race struct {
+	mu           sync.Mutex
+	sendMu       sync.Mutex
+	outbox       [][]byte
+	roomID       string
+	state        State
+	round        int
+	passage      passage.Spec
+	startAt      time.Time
+	timeLimit    time.Duration
+	participants map[string]*Participant
+	timer        *time.Timer
+	broadcast    BroadcastFunc
+	persist      *persister
+}
+
+func newRace(roomID string, broadcast BroadcastFunc, persist *persister) *Race {
+	return &Race{
+		roomID:       roomID,
+		state:        StateWaiting,
+		timeLimit:    DefaultTimeLimit,
+		participants: make(map[string]*Participant),
+		broadcast:    broadcast,
+		persist:      persist,
+	}
+}
+
+// restoreRace rebuilds a race from saved state. Its timers are not armed
+// until resume is called.
+func restoreRace(snap *models.RaceSnapshot, broadcast BroadcastFunc, persist *persister) *Race {
+	r := newRace(snap.RoomID, broadcast, persist)
+	r.state = State(snap.State)
+	r.round = snap.Round
+	r.passage = snap.Passage
+	if snap.StartAt != 0 {
+		r.startAt = time.UnixMilli(snap.StartAt)
+	}
+	if snap.TimeLimit > 0 {
+		r.timeLimit = time.Duration(snap.TimeLimit) * time.Second
+	}
+	for _, sp := range snap.Participants {
+		p := &Participant{
+			UserID:   sp.UserID,
+			Username: sp.Username,
+			Ready:    sp.Ready,
+			Racing:   sp.Racing,
+			Finished: sp.Finished,
+			WPM:      sp.WPM,
+			Accuracy: sp.Accuracy,
+			Progress: sp.Progress,
+			Unranked: sp.Unranked,
+		}
+		if sp.FinishedAt != 0 {
+			p.FinishedAt = time.UnixMilli(sp.FinishedAt)
+		}
+		r.participants[p.UserID] = p
+	}
+	return r
+}
+
+// resume re-arms the timer of a restored race, finishing it straight away if
+// its time ran out while no instance was running it.
+func (r *Race) resume() {
+	r.mu.Lock()
+	defer r.unlock()
+
+	round := r.round
+	switch r.state {
+	case StateCountdown:
+		if wait := time.Until(r.startAt); wait > 0 {
+			r.timer = time.AfterFunc(wait, func() { r.run(round) })
+			return
+		}
+		r.state = StateRunning
+		fallthrough
+	case StateRunning:
+		if left := time.Until(r.startAt.Add(r.timeLimit)); left > 0 {
+			r.timer = time.AfterFunc(left, func() { r.timeUp(round) })
+			r.save()
+			return
+		}
+		r.end()
+		r.save()
+	}
+}
+
+// sync brings a restored race in line with the room's current members: it
+// adds anyone missing, and drops anyone who has gone unless they are part of
+// a race still under way and may yet reconnect.
+func (r *Race) sync(members map[string]string) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	for userID, username := range members {
+		if p, ok := r.participants[userID]; ok {
+			p.Username = username
+			continue
+		}
+		r.participants[userID] = &Participant{UserID: userID, Username: username}
+	}
+
+	underway := r.state == StateCountdown || r.state == StateRunning
+	for userID, p := range r.participants {
+		if _, ok := members[userID]; !ok && !(underway && p.Racing) {
+			delete(r.participants, userID)
+		}
+	}
+
+	if r.state == StateWaiting {
+		r.maybeStartCountdown()
+	}
+	r.save()
+	r.sendState()
+}
+
+// close stops the race's timers once its room has been discarded.
+func (r *Race) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopTimer()
+	r.round++
+}
+
+// empty reports whether the race has no participants left.
+func (r *Race) empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.participants) == 0
+}
+
+// Passage returns the spec of the passage for the current race
+func (r *Race) Passage() passage.Spec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.passage
+}
+
+// testFor returns the test a user is racing in, if they are in the race
+// under way and have not yet finished it.
+func (r *Race) testFor(userID string) (models.IssuedTest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.participants[userID]
+	if !ok || r.state != StateRunning || !p.Racing || p.Finished {
+		return models.IssuedTest{}, false
+	}
+	return models.IssuedTest{
+		Passage:  r.passage,
+		Mode:     models.ModeRace,
+		Language: models.DefaultLanguage,
+		Duration: int(r.timeLimit / time.Second),
+		Start:    r.startAt,
+	}, true
+}
+
+// State returns the race's current stage
+func (r *Race) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *Race) join(userID, username string) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	if p, ok := r.participants[userID]; ok {
+		p.Username = username
+	} else {
+		r.participants[userID] = &Participant{UserID: userID, Username: username}
+	}
+	r.save()
+	r.sendState()
+}
+
+// leave removes a participant and reports whether the room is now empty.
+func (r *Race) leave(userID string) bool {
+	r.mu.Lock()
+	defer r.unlock()
+
+	delete(r.participants, userID)
+	if len(r.participants) == 0 {
+		// Anyone joining before the race is discarded starts afresh
+		r.stopTimer()
+		r.round++
+		r.reset()
+		return true
+	}
+
+	switch r.state {
+	case StateWaiting:
+		r.maybeStartCountdown()
+	case StateCountdown:
+		if r.racers() == 0 {
+			r.stopTimer()
+			r.round++
+			r.state = StateWaiting
+		}
+	case StateRunning:
+		r.maybeFinish()
+	}
+	r.save()
+	return false
+}
+
+func (r *Race) ready(userID string) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	p, ok := r.participants[userID]
+	if !ok {
+		return
+	}
+
+	if r.state == StateFinished {
+		r.reset()
+	}
+	if r.state != StateWaiting {
+		return
+	}
+
+	p.Ready = true
+	r.maybeStartCountdown()
+	r.save()
+}
+
+func (r *Race) progress(userID string, progress, wpm int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.participants[userID]
+	if !ok || r.state != StateRunning || !p.Racing || p.Finished {
+		return
+	}
+	p.Progress = progress
+	p.WPM = wpm
+	r.save()
+}
+
+func (r *Race) finish(userID string, wpm int, accuracy float64, ranked bool) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	p, ok := r.participants[userID]
+	if !ok || r.state != StateRunning || !p.Racing || p.Finished {
+		return
+	}
+	p.Finished = true
+	p.Progress = 100
+	p.WPM = wpm
+	p.Accuracy = accuracy
+	p.FinishedAt = time.Now()
+	p.Unranked = !ranked
+
+	r.maybeFinish()
+	r.save()
+}
+
+// reset prepares a finished race for the next round, keeping its members.
+func (r *Race) reset() {
+	r.state = StateWaiting
+	r.passage = passage.Spec{}
+	r.startAt = time.Time{}
+	for _, p := range r.participants {
+		*p = Participant{UserID: p.UserID, Username: p.Username}
+	}
+}
+
+// maybeStartCountdown begins the countdown once every member is ready.
+func (r *Race) maybeStartCountdown() {
+	if len(r.participants) == 0 {
+		return
+	}
+	for _, p := range r.participants {
+		if !p.Ready {
+			return
+		}
+	}
+
+	r.round++
+	round := r.round
+	r.state = StateCountdown
+	r.passage = passage.NewSpec(passage.Medium, passage.DefaultWords)
+	r.startAt = time.Now().Add(CountdownDuration)
+	for _, p := range r.participants {
+		p.Racing = true
+	}
+
+	r.send(models.EventGameStart, models.GameStartPayload{
+		RoomID:    r.roomID,
+		Passage:   r.passage,
+		Text:      r.passage.Text(),
+		StartAt:   r.startAt.UnixMilli(),
+		TimeLimit: int(r.timeLimit / time.Second),
+	})
+	log.Printf("Race in room %s starts at %s", r.roomID, r.startAt.Format(time.RFC3339))
+
+	r.stopTimer()
+	r.timer = time.AfterFunc(CountdownDuration, func() { r.run(round) })
+}
+
+// run moves the race from countdown to running and arms the time limit.
+func (r *Race) run(round int) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	if r.round != round || r.state != StateCountdown {
+		return
+	}
+	r.state = StateRunning
+	r.timer = time.AfterFunc(time.Until(r.startAt.Add(r.timeLimit)), func() { r.timeUp(round) })
+	r.save()
+}
+
+func (r *Race) timeUp(round int) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	if r.round != round || r.state != StateRunning {
+		return
+	}
+	r.end()
+	r.save()
+}
+
+// maybeFinish ends the race once every racer still in the room has finished.
+func (r *Race) maybeFinish() {
+	for _, p := range r.participants {
+		if p.Racing && !p.Finished {
+			return
+		}
+	}
+	r.end()
+}
+
+// end finishes the race and broadcasts the final standings.
+func (r *Race) end() {
+	r.stopTimer()
+	r.round++
+	r.state = StateFinished
+
+	r.send(models.EventGameResults, models.GameResultsPayload{
+		RoomID:    r.roomID,
+		Standings: r.standings(),
+	})
+	log.Printf("Race in room %s finished", r.roomID)
+}
+
+// standings ranks finishers by completion time, followed by everyone else by
+// progress and then speed. Finishers whose result was not verified are listed
+// last and left unranked.
+func (r *Race) standings() []models.RaceStanding {
+	var racers []*Participant
+	for _, p := range r.participants {
+		if p.Racing {
+			racers = append(racers, p)
+		}
+	}
+
+	sort.Slice(racers, func(i, j int) bool {
+		a, b := racers[i], racers[j]
+		if a.Unranked != b.Unranked {
+			return b.Unranked
+		}
+		if a.Finished != b.Finished {
+			return a.Finished
+		}
+		if a.Finished {
+			return a.FinishedAt.Before(b.FinishedAt)
+		}
+		if a.Progress != b.Progress {
+			return a.Progress > b.Progress
+		}
+		return a.WPM > b.WPM
+	})
+
+	standings := make([]models.RaceStanding, 0, len(racers))
+	for i, p := range racers {
+		standing := models.RaceStanding{
+			Rank:     i + 1,
+			Unranked: p.Unranked,
+			UserID:   p.UserID,
+			Username: p.Username,
+			WPM:      p.WPM,
+			Accuracy: p.Accuracy,
+			Progress: p.Progress,
+			Finished: p.Finished,
+		}
+		if p.Finished {
+			standing.Time = p.FinishedAt.Sub(r.startAt).Milliseconds()
+		}
+		if p.Unranked {
+			standing.Rank = 0
+		}
+		standings = append(standings, standing)
+	}
+	return standings
+}
+
+func (r *Race) racers() int {
+	n := 0
+	for _, p := range r.participants {
+		if p.Racing {
+			n++
+		}
+	}
+	return n
+}
+
+// save queues the race's current state to be stored.
+func (r *Race) save() {
+	if r.persist != nil {
+		r.persist.save(r.snapshot())
+	}
+}
+
+func (r *Race) snapshot() *models.RaceSnapshot {
+	snap := &models.RaceSnapshot{
+		RoomID:       r.roomID,
+		State:        string(r.state),
+		Round:        r.round,
+		Passage:      r.passage,
+		TimeLimit:    int(r.timeLimit / time.Second),
+		Participants: r.participantStates(),
+	}
+	if !r.startAt.IsZero() {
+		snap.StartAt = r.startAt.UnixMilli()
+	}
+	return snap
+}
+
+func (r *Race) participantStates() []models.RaceParticipant {
+	states := make([]models.RaceParticipant, 0, len(r.participants))
+	for _, p := range r.participants {
+		state := models.RaceParticipant{
+			UserID:   p.UserID,
+			Username: p.Username,
+			Ready:    p.Ready,
+			Racing:   p.Racing,
+			Finished: p.Finished,
+			WPM:      p.WPM,
+			Accuracy: p.Accuracy,
+			Progress: p.Progress,
+			Unranked: p.Unranked,
+		}
+		if !p.FinishedAt.IsZero() {
+			state.FinishedAt = p.FinishedAt.UnixMilli()
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].UserID < states[j].UserID })
+	return states
+}
+
+// sendState lets the room catch up with a race under way, so that members
+// who join or reconnect mid-race can pick it up where it is.
+func (r *Race) sendState() {
+	if r.state != StateCountdown && r.state != StateRunning {
+		return
+	}
+	r.send(models.EventRaceState, models.RaceStatePayload{
+		RoomID:       r.roomID,
+		State:        string(r.state),
+		Passage:      r.passage,
+		Text:         r.passage.Text(),
+		StartAt:      r.startAt.UnixMilli(),
+		TimeLimit:    int(r.timeLimit / time.Second),
+		Participants: r.participantStates(),
+	})
+}
+
+func (r *Race) stopTimer() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// send queues an event for the room. It is broadcast by unlock.
+func (r *Race) send(eventType models.EventType, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s payload: %v", eventType, err)
+		return
+	}
+	msg, err := json.Marshal(models.WSEvent{Type: eventType, Payload: data})
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", eventType, err)
+		return
+	}
+	r.outbox = append(r.outbox, msg)
+}
+
+// unlock releases mu and then broadcasts the events queued while it was
+// held. sendMu is taken before mu is released, so events go out in the
+// order they were queued.
+func (r *Race) unlock() {
+	outbox := r.outbox
+	r.outbox = nil
+	if len(outbox) == 0 {
+		r.mu.Unlock()
+		return
+	}
+
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	r.mu.Unlock()
+	for _, msg := range outbox {
+		r.broadcast(r.roomID, msg)
+	}
+}
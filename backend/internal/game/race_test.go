@@ -0,0 +1,93 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+)
+
+// memoryStore is a RaceStore holding a single room's saved race
+type memoryStore struct {
+	mu   sync.Mutex
+	snap *models.RaceSnapshot
+}
+
+func (s *memoryStore) SaveRace(ctx context.Context, race *models.RaceSnapshot, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap = race
+	return nil
+}
+
+func (s *memoryStore) GetRace(ctx context.Context, roomID string) (*models.RaceSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snap, nil
+}
+
+func (s *memoryStore) DeleteRace(ctx context.Context, roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snap = nil
+	return nil
+}
+
+// TestBroadcastUnlocked checks that events are broadcast with neither the
+// manager nor the race locked, as a broadcast may block on the network.
+func TestBroadcastUnlocked(t *testing.T) {
+	const roomID = "room"
+	store := &memoryStore{snap: &models.RaceSnapshot{
+		RoomID:    roomID,
+		State:     string(StateRunning),
+		Round:     1,
+		Passage:   passage.NewSpec(passage.Medium, passage.DefaultWords),
+		StartAt:   time.Now().Add(-time.Second).UnixMilli(),
+		TimeLimit: 60,
+		Participants: []models.RaceParticipant{
+			{UserID: "a", Username: "A", Ready: true, Racing: true},
+			{UserID: "b", Username: "B", Ready: true, Racing: true},
+		},
+	}}
+
+	var m *Manager
+	var events []models.EventType
+	m = NewManager(func(roomID string, data []byte) {
+		// Both would deadlock if the broadcast were made under a lock
+		m.Rooms()
+		if race := m.Race(roomID); race != nil {
+			race.State()
+		}
+		var event models.WSEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Error(err)
+		}
+		events = append(events, event.Type)
+	}, store)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Adopt(roomID, map[string]string{"a": "A", "b": "B"})
+		m.Finish(roomID, "a", 60, 100, true)
+		// The last racer still going leaving ends the race
+		m.Leave(roomID, "b")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked broadcasting an event")
+	}
+
+	want := []models.EventType{models.EventRaceState, models.EventGameResults}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	if state := m.Race(roomID).State(); state != StateFinished {
+		t.Fatalf("race is %s, want %s", state, StateFinished)
+	}
+}
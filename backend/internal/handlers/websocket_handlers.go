@@ -3,153 +3,292 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/nikhilsahni7/typeMaster/backend/internal/achievements"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
 )
 
 type Handler struct {
-	MatchRepo  *repository.MatchRepository
-	UserRepo   *repository.UserRepository
-	RedisCache *repository.RedisCache
+	Matches      repository.MatchStore
+	Users        repository.UserStore
+	Leaderboards repository.LeaderboardStore
+	Cache        repository.ResultCache
+	Passages     repository.PassageStore
+	Achievements *achievements.Service
+
+	// Notify sends an event to every connection of a user. It is set once the
+	// hub exists.
+	Notify func(userID string, data []byte)
 }
 
-func NewHandler(matchRepo *repository.MatchRepository, userRepo *repository.UserRepository, redisCache *repository.RedisCache) *Handler {
+func NewHandler(stores repository.Stores, achievementService *achievements.Service) *Handler {
 	return &Handler{
-		MatchRepo:  matchRepo,
-		UserRepo:   userRepo,
-		RedisCache: redisCache,
+		Matches:      stores.Matches,
+		Users:        stores.Users,
+		Leaderboards: stores.Leaderboards,
+		Cache:        stores.Cache,
+		Passages:     stores.Passages,
+		Achievements: achievementService,
 	}
 }
 
-// HandleEvent routes messages
-func (h *Handler) HandleEvent(message []byte) {
-	var event models.WSEvent
-	if err := json.Unmarshal(message, &event); err != nil {
-		log.Printf("Error unmarshaling event: %v", err)
-		return
-	}
+const (
+	maxRoomIDLength  = 64
+	maxChatLength    = 500
+	maxLiveWPM       = 1000 // Live figures are noisy early in a race; this only rules out nonsense
+	maxProgress      = 100
+	maxAccuracyValue = 100
+
+	// Allowed drift between the server's clock and a keystroke log, for a
+	// result checked against the time its test has been under way.
+	clockTolerance = time.Second
+)
 
-	switch event.Type {
-	case models.EventJoinLobby:
-		h.handleJoinLobby(event.Payload)
-	case models.EventTypingUpdate:
-		h.handleTypingUpdate(event.Payload)
-	case models.EventChatMessage:
-		h.handleChatMessage(event.Payload)
-	case models.EventGameEnd:
-		h.handleGameEnd(event.Payload)
-	default:
-		log.Printf("Unknown event type: %s", event.Type)
+// JoinLobby validates a join_lobby payload. Room IDs are short and made of
+// letters, digits, '-' and '_'.
+func (h *Handler) JoinLobby(identity auth.Identity, p *models.JoinLobbyPayload) error {
+	if p.RoomID == "" || len(p.RoomID) > maxRoomIDLength {
+		return protocol.Invalid("room_id must be 1 to %d characters", maxRoomIDLength)
+	}
+	for _, r := range p.RoomID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return protocol.Invalid("room_id may only contain letters, digits, '-' and '_'")
+		}
 	}
+
+	log.Printf("User %s joined lobby %s", identity.UserID, p.RoomID)
+	return nil
 }
 
-func (h *Handler) handleJoinLobby(payload json.RawMessage) {
-	type JoinPayload struct {
-		UserID   string `json:"user_id"`
-		Username string `json:"username"`
-		RoomID   string `json:"room_id"`
+// TypingUpdate validates a racer's live stats.
+func (h *Handler) TypingUpdate(identity auth.Identity, p *models.TypingPayload) error {
+	switch {
+	case p.Progress < 0 || p.Progress > maxProgress:
+		return protocol.Invalid("progress must be between 0 and %d", maxProgress)
+	case p.WPM < 0 || p.WPM > maxLiveWPM:
+		return protocol.Invalid("wpm must be between 0 and %d", maxLiveWPM)
+	case p.Accuracy < 0 || p.Accuracy > maxAccuracyValue:
+		return protocol.Invalid("accuracy must be between 0 and %d", maxAccuracyValue)
 	}
+	return nil
+}
 
-	var p JoinPayload
-	if err := json.Unmarshal(payload, &p); err != nil {
-		log.Printf("Error unmarshaling join payload: %v", err)
-		return
+// ChatMessage validates a chat message, trimming surrounding whitespace.
+func (h *Handler) ChatMessage(identity auth.Identity, p *models.ChatMessagePayload) error {
+	p.Message = strings.TrimSpace(p.Message)
+	if n := utf8.RuneCountInString(p.Message); n == 0 || n > maxChatLength {
+		return protocol.Invalid("message must be 1 to %d characters", maxChatLength)
 	}
 
-	log.Printf("User %s joined lobby %s", p.UserID, p.RoomID)
+	log.Printf("Chat from %s: %s", identity.UserID, p.Message)
+	return nil
+}
 
-	// Create guest if needed
-	if p.UserID != "" {
-		username := p.Username
-		if username == "" {
-			username = "Guest_" + p.UserID[:8]
-		}
+// GameEnd checks a finished game against its keystroke log and saves it,
+// returning the result as saved. The result is for race, the test of the race
+// the player is in, or else for the test last issued to them for solo play;
+// its log is replayed on that test's passage and it is recorded under that
+// test's mode and language. A result without a log, one the log contradicts,
+// or one that ran longer than its test allows, or than the time since it
+// began, is refused.
+func (h *Handler) GameEnd(identity auth.Identity, race *models.IssuedTest, p *models.GameEndPayload) (*models.MatchResult, error) {
+	if len(p.Keystrokes) == 0 {
+		return nil, h.reject(identity, "no keystroke log was submitted")
+	}
 
-		err := h.UserRepo.CreateGuest(context.Background(), p.UserID, username)
+	test := race
+	if test == nil {
+		issued, err := h.Passages.TakePassage(context.Background(), identity.UserID)
+		if errors.Is(err, repository.ErrCacheMiss) {
+			return nil, h.reject(identity, "no passage was issued for this result")
+		}
 		if err != nil {
-			log.Printf("Failed to create guest user: %v", err)
+			log.Printf("Failed to load issued passage for %s: %v", identity.UserID, err)
+			return nil, &protocol.EventError{Code: models.CodeInternal, Message: "failed to check result"}
 		}
+		test = issued
 	}
-}
-
-func (h *Handler) handleTypingUpdate(payload json.RawMessage) {
-	var p models.TypingPayload
-	if err := json.Unmarshal(payload, &p); err != nil {
-		return
+	if p.Passage == nil || !sameSpec(*p.Passage, test.Passage) {
+		return nil, h.reject(identity, "result is not for the passage the server issued")
 	}
-	log.Printf("User %s is at %d%% progress (WPM: %d)", p.UserID, p.Progress, p.WPM)
-}
-
-func (h *Handler) handleChatMessage(payload json.RawMessage) {
-	var p models.ChatPayload
-	if err := json.Unmarshal(payload, &p); err != nil {
-		return
+	if p.Duration < 0 || test.Duration > 0 && p.Duration > test.Duration {
+		return nil, h.reject(identity, fmt.Sprintf("a %s test cannot last %d seconds", test.Mode, p.Duration))
 	}
-	log.Printf("Chat from %s: %s", p.UserID, p.Message)
-}
 
-func (h *Handler) handleGameEnd(payload json.RawMessage) {
-	var temp struct {
-		UserID            string  `json:"user_id"`
-		WPM               int     `json:"wpm"`
-		RawWPM            int     `json:"raw_wpm"`
-		Accuracy          float64 `json:"accuracy"`
-		Consistency       float64 `json:"consistency"`
-		ErrorCount        int     `json:"error_count"`
-		Mode              string  `json:"mode"`
-		Language          string  `json:"language"`
-		Duration          int     `json:"duration"`
-		BadKeys           any     `json:"bad_keys"`
-		ImprovementNeeded string  `json:"improvement_needed"`
-	}
-
-	if err := json.Unmarshal(payload, &temp); err != nil {
-		log.Printf("error parsing game end payload: %v", err)
-		return
+	check := anticheat.Check(&test.Passage, p.Keystrokes, anticheat.Claim{
+		WPM:      p.WPM,
+		Accuracy: p.Accuracy,
+		Duration: p.Duration,
+	})
+	if check.Verdict == anticheat.Rejected {
+		return nil, h.reject(identity, strings.Join(check.Reasons, "; "))
 	}
+	if since := time.Since(test.Start); check.Stats.Elapsed > since+clockTolerance {
+		return nil, h.reject(identity, fmt.Sprintf("result takes %s but its test began %s ago", check.Stats.Elapsed.Round(time.Second), since.Round(time.Second)))
+	}
+	// Trust only what the keystroke log shows
+	p.WPM = check.Stats.WPM
+	p.RawWPM = check.Stats.RawWPM
+	p.Accuracy = check.Stats.Accuracy
+	p.Consistency = check.Stats.Consistency
+	p.ErrorCount = check.Stats.ErrorCount
+	p.BadKeys = check.Stats.BadKeys
+	p.ImprovementNeeded = improvementFor(check.Stats.BadKeys)
 
 	// Convert BadKeys to JSON string
 	badKeysJSON := "{}"
-	if temp.BadKeys != nil {
-		bytes, err := json.Marshal(temp.BadKeys)
+	if p.BadKeys != nil {
+		bytes, err := json.Marshal(p.BadKeys)
 		if err == nil {
 			badKeysJSON = string(bytes)
 		}
 	}
 
 	match := &models.MatchResult{
-		UserID:            temp.UserID,
-		WPM:               temp.WPM,
-		RawWPM:            temp.RawWPM,
-		Accuracy:          temp.Accuracy,
-		Consistency:       temp.Consistency,
-		ErrorCount:        temp.ErrorCount,
-		Mode:              temp.Mode,
-		Language:          temp.Language,
-		Duration:          temp.Duration,
+		UserID:            identity.UserID,
+		WPM:               p.WPM,
+		RawWPM:            p.RawWPM,
+		Accuracy:          p.Accuracy,
+		Consistency:       p.Consistency,
+		ErrorCount:        p.ErrorCount,
+		Mode:              test.Mode,
+		Language:          test.Language,
+		Duration:          p.Duration,
 		BadKeys:           badKeysJSON,
-		ImprovementNeeded: temp.ImprovementNeeded,
+		ImprovementNeeded: p.ImprovementNeeded,
+		Verification:      string(check.Verdict),
+		FlagReasons:       strings.Join(check.Reasons, "; "),
+		KeyCounts:         jsonString(check.Stats.KeyCounts),
+		BigramCounts:      jsonString(check.Stats.BigramCounts),
+		BadBigrams:        jsonString(check.Stats.BadBigrams),
 	}
 
-	log.Printf("Received game_end: WPM=%d, BadKeys=%s", match.WPM, match.BadKeys)
+	log.Printf("Received game_end: WPM=%d, BadKeys=%s, Verification=%s", match.WPM, match.BadKeys, match.Verification)
 
-	err := h.MatchRepo.CreateMatch(context.Background(), match)
+	err := h.Matches.CreateMatch(context.Background(), match)
 	if err != nil {
 		log.Printf("Failed to save match result: %v", err)
-		return
+		return nil, &protocol.EventError{Code: models.CodeInternal, Message: "failed to save result"}
 	}
 	log.Printf("Match saved successfully! ID: %s", match.ID)
 
+	if err := h.Cache.InvalidateMatchCaches(context.Background(), match.UserID); err != nil {
+		log.Printf("Failed to invalidate match caches: %v", err)
+	}
+
+	h.recordProgress(match)
+
+	// Only results backed by a clean keystroke log are ranked
+	if check.Verdict != anticheat.Verified {
+		return match, nil
+	}
+
+	board, err := models.BoardForMatch(match)
+	if err != nil {
+		log.Printf("Match %s has no leaderboard: %v", match.ID, err)
+		return match, nil
+	}
+
+	playedAt, err := time.Parse(time.RFC3339, match.CreatedAt)
+	if err != nil {
+		playedAt = time.Now()
+	}
+
 	// Update Leaderboard
-	username, err := h.UserRepo.GetUser(context.Background(), match.UserID)
-	if err == nil && username != "" {
-		err = h.RedisCache.UpdateLeaderboard(context.Background(), match.UserID, username, match.WPM)
+	err = h.Leaderboards.UpdateLeaderboard(context.Background(), board, match.UserID, match.WPM, match.ID, playedAt)
+	if err != nil {
+		log.Printf("Failed to update leaderboard: %v", err)
+	} else {
+		log.Printf("Leaderboard updated for %s with WPM %d", match.UserID, match.WPM)
+	}
+	return match, nil
+}
+
+// reject refuses a game_end, saving nothing.
+func (h *Handler) reject(identity auth.Identity, reason string) error {
+	log.Printf("Rejected game_end from %s: %s", identity.UserID, reason)
+	return &protocol.EventError{Code: models.CodeRejected, Message: reason}
+}
+
+func sameSpec(a, b passage.Spec) bool {
+	return a.Seed == b.Seed && a.Difficulty == b.Difficulty && a.Words == b.Words && slices.Equal(a.Focus, b.Focus)
+}
+
+// recordProgress awards XP for a saved match and tells the player about any
+// achievements it unlocked
+func (h *Handler) recordProgress(match *models.MatchResult) {
+	unlock, err := h.Achievements.Record(context.Background(), match)
+	if err != nil {
+		log.Printf("Failed to record achievements for %s: %v", match.UserID, err)
+		return
+	}
+	if h.Notify == nil {
+		return
+	}
+
+	for _, a := range unlock.Unlocked {
+		payload, err := json.Marshal(models.AchievementUnlockedPayload{
+			Achievement: a,
+			XP:          unlock.XP,
+			Level:       unlock.Level,
+		})
+		if err != nil {
+			log.Printf("Error marshaling achievement: %v", err)
+			continue
+		}
+		data, err := json.Marshal(models.WSEvent{Type: models.EventAchievementUnlocked, Payload: payload})
 		if err != nil {
-			log.Printf("Failed to update leaderboard: %v", err)
-		} else {
-			log.Printf("Leaderboard updated for %s with WPM %d", username, match.WPM)
+			log.Printf("Error marshaling achievement event: %v", err)
+			continue
+		}
+		h.Notify(match.UserID, data)
+	}
+}
+
+// improvementFor names the keys missed most often, the same way the client
+// words it.
+func improvementFor(badKeys map[string]int) string {
+	keys := make([]string, 0, len(badKeys))
+	for k := range badKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if badKeys[keys[i]] != badKeys[keys[j]] {
+			return badKeys[keys[i]] > badKeys[keys[j]]
 		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) == 0 {
+		return "Great job! Maintain accuracy."
+	}
+
+	names := make([]string, 0, 3)
+	for _, k := range keys[:min(3, len(keys))] {
+		if k == " " {
+			k = "SPACE"
+		}
+		names = append(names, strings.ToUpper(k))
+	}
+	return "Focus on: " + strings.Join(names, ", ")
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
 	}
+	return string(data)
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/achievements"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// typed builds the game_end of a clean test on spec that ran for seconds,
+// with keystrokes at about 60 WPM for the first typing seconds of it.
+func typed(spec passage.Spec, seconds, typing int) *models.GameEndPayload {
+	limit := int64(typing) * 1000
+	var keys []anticheat.Keystroke
+	var at int64
+	for i, r := range []rune(spec.Text()) {
+		if at > limit {
+			break
+		}
+		keys = append(keys, anticheat.Keystroke{Key: string(r), Time: at})
+		at += 180 + int64(i%5)*10
+	}
+
+	stats, err := anticheat.Replay(spec.Text(), keys, time.Duration(seconds)*time.Second)
+	if err != nil {
+		panic(err)
+	}
+	return &models.GameEndPayload{
+		WPM:        stats.WPM,
+		Accuracy:   stats.Accuracy,
+		Mode:       "time_60",
+		Language:   "klingon",
+		Duration:   seconds,
+		Passage:    &spec,
+		Keystrokes: keys,
+	}
+}
+
+func TestGameEnd(t *testing.T) {
+	spec := passage.NewSpec(passage.Medium, passage.WordsFor(15, anticheat.MaxHumanWPM))
+	began := time.Now().Add(-time.Minute)
+	timed := models.IssuedTest{Passage: spec, Mode: models.TimedMode(15), Language: models.DefaultLanguage, Duration: 15, Start: began}
+
+	tests := []struct {
+		name     string
+		issued   *models.IssuedTest
+		result   *models.GameEndPayload
+		mode     string
+		duration int
+		ranked   bool
+	}{
+		{
+			name:     "recorded as the issued test",
+			issued:   &timed,
+			result:   typed(spec, 15, 15),
+			mode:     "time_15",
+			duration: 15,
+			ranked:   true,
+		},
+		{
+			name:     "short run still counts for the issued length",
+			issued:   &timed,
+			result:   typed(spec, 5, 5),
+			mode:     "time_15",
+			duration: 5,
+			ranked:   true,
+		},
+		{
+			name:     "untimed",
+			issued:   &models.IssuedTest{Passage: spec, Mode: models.ModeWords, Language: models.DefaultLanguage, Start: began},
+			result:   typed(spec, 20, 20),
+			mode:     models.ModeWords,
+			duration: 20,
+		},
+		{
+			name:   "longer than the test allows",
+			issued: &timed,
+			result: typed(spec, 20, 20),
+		},
+		{
+			name:   "keystrokes past the claimed duration",
+			issued: &timed,
+			result: func() *models.GameEndPayload {
+				p := typed(spec, 10, 10)
+				p.Duration = 5
+				return p
+			}(),
+		},
+		{
+			name:   "longer than the time since the test began",
+			issued: &models.IssuedTest{Passage: spec, Mode: models.TimedMode(15), Language: models.DefaultLanguage, Duration: 15, Start: time.Now()},
+			result: typed(spec, 15, 15),
+		},
+		{
+			name:   "nothing issued",
+			result: typed(spec, 15, 15),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			stores := repository.NewMemoryStores()
+			h := NewHandler(stores, achievements.NewService(stores.Matches, stores.Achievements))
+			user, err := stores.Users.CreateGuestAccount(ctx, "guest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.issued != nil {
+				if err := stores.Passages.IssuePassage(ctx, user.ID, *tt.issued, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			match, err := h.GameEnd(auth.Identity{UserID: user.ID, Username: user.Username}, nil, tt.result)
+			if tt.mode == "" {
+				var refused *protocol.EventError
+				if !errors.As(err, &refused) || refused.Code != models.CodeRejected {
+					t.Fatalf("got %v, want the result rejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match.Mode != tt.mode || match.Language != models.DefaultLanguage || match.Duration != tt.duration {
+				t.Fatalf("recorded as %s/%s/%ds, want %s/%s/%ds", match.Mode, match.Language, match.Duration, tt.mode, models.DefaultLanguage, tt.duration)
+			}
+
+			board := models.Board{Mode: "time_15", Language: models.DefaultLanguage, Duration: 15}
+			entries, _, err := stores.Leaderboards.GetTopPlayers(ctx, board, models.AllTime, time.Time{}, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ranked := len(entries) == 1; ranked != tt.ranked {
+				t.Fatalf("ranked on %v: %v, want %v", board, ranked, tt.ranked)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockID serialises migrations across instances starting at the same time.
+const lockID = 7240315
+
+// handMadeVersion is the schema databases were set up with by hand before
+// migrations were tracked: 001 to 003.
+const handMadeVersion = 3
+
+var (
+	// ErrSchemaTooNew means the database was migrated by a newer binary.
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+	// ErrNoHistory means the schema was set up by hand, without the versions
+	// table, and is not the one Up recognises. Run baseline with the version
+	// it matches.
+	ErrNoHistory = errors.New("database has tables but no migration history; run `api migrate baseline <version>`")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // Empty when the migration cannot be rolled back
+}
+
+// Applied is a migration recorded in the versions table
+type Applied struct {
+	Version   int
+	Name      string
+	AppliedAt string
+}
+
+// Migrator applies migrations and records them in schema_migrations
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+// New loads the migrations in fsys, which must be NNN_name.up.sql files with
+// optional matching .down.sql files.
+func New(db *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		m := fileName.FindStringSubmatch(path.Base(file))
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 001_name.up.sql", file)
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrations returns the migrations this binary knows about, oldest first
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Latest is the highest version this binary knows about
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied version, or 0 on a fresh database
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.locked(ctx, func(tx pgx.Tx) error {
+		var err error
+		version, err = current(ctx, tx)
+		return err
+	})
+	return version, err
+}
+
+// Check fails when the schema is newer than this binary, and returns the
+// number of migrations still to apply.
+func (m *Migrator) Check(ctx context.Context) (int, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if version > m.Latest() {
+		return 0, fmt.Errorf("%w: database is at %d, binary knows up to %d", ErrSchemaTooNew, version, m.Latest())
+	}
+
+	pending := 0
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	for _, mig := range m.migrations {
+		ran := false
+		err := m.locked(ctx, func(tx pgx.Tx) error {
+			version, err := current(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if version > m.Latest() {
+				return fmt.Errorf("%w: database is at %d, binary knows up to %d", ErrSchemaTooNew, version, m.Latest())
+			}
+			// Another instance may have got here first
+			if mig.Version <= version {
+				return nil
+			}
+			if version == 0 {
+				if version, err = m.adoptUnmanaged(ctx, tx); err != nil {
+					return err
+				}
+				if mig.Version <= version {
+					return nil
+				}
+			}
+
+			if _, err := tx.Exec(ctx, mig.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			ran = true
+			return record(ctx, tx, mig)
+		})
+		if err != nil {
+			return applied, err
+		}
+		if ran {
+			applied = append(applied, mig)
+		}
+	}
+	return applied, nil
+}
+
+// Down rolls back the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	for range steps {
+		var mig Migration
+		err := m.locked(ctx, func(tx pgx.Tx) error {
+			version, err := current(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if version == 0 {
+				return nil
+			}
+
+			found := false
+			for _, candidate := range m.migrations {
+				if candidate.Version == version {
+					mig, found = candidate, true
+				}
+			}
+			if !found {
+				return fmt.Errorf("%w: no migration %d to roll back", ErrSchemaTooNew, version)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+
+			if _, err := tx.Exec(ctx, mig.Down); err != nil {
+				return fmt.Errorf("rolling back %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if mig.Version == 0 {
+			break
+		}
+		reverted = append(reverted, mig)
+	}
+	return reverted, nil
+}
+
+// Baseline records every migration up to version as applied without running
+// it, for databases whose schema was set up by hand.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	if version > m.Latest() {
+		return fmt.Errorf("no migration %d: binary knows up to %d", version, m.Latest())
+	}
+	return m.locked(ctx, func(tx pgx.Tx) error {
+		current, err := current(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if current != 0 {
+			return fmt.Errorf("database already has migration history at version %d", current)
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			if err := record(ctx, tx, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// History lists the applied migrations, oldest first
+func (m *Migrator) History(ctx context.Context) ([]Applied, error) {
+	var history []Applied
+	err := m.locked(ctx, func(tx pgx.Tx) error {
+		if err := ensureTable(ctx, tx); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, `
+			SELECT version, name, to_char(applied_at, 'YYYY-MM-DD HH24:MI:SS TZ')
+			FROM schema_migrations
+			ORDER BY version`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a Applied
+			if err := rows.Scan(&a.Version, &a.Name, &a.AppliedAt); err != nil {
+				return err
+			}
+			history = append(history, a)
+		}
+		return rows.Err()
+	})
+	return history, err
+}
+
+// locked runs fn in a transaction holding the migration lock. A transaction
+// lock rather than a session lock, so it also works through a transaction
+// pooler.
+func (m *Migrator) locked(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func ensureTable(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+func current(ctx context.Context, tx pgx.Tx) (int, error) {
+	if err := ensureTable(ctx, tx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func record(ctx context.Context, tx pgx.Tx, mig Migration) error {
+	_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+	return err
+}
+
+// adoptUnmanaged deals with a database whose tables predate the versions
+// table, rather than fail halfway through re-creating them. The hand-made
+// 001 to 003 schema is recorded as applied and its version returned; any
+// other schema is refused.
+func (m *Migrator) adoptUnmanaged(ctx context.Context, tx pgx.Tx) (int, error) {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT to_regclass('public.users') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	// Columns added by 002 and 003, and the first one added after them
+	var guests, analytics, verification bool
+	err = tx.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = 'users' AND column_name = 'is_guest'),
+			EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = 'matches' AND column_name = 'improvement_needed'),
+			EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = 'matches' AND column_name = 'verification')`,
+	).Scan(&guests, &analytics, &verification)
+	if err != nil {
+		return 0, err
+	}
+	if !guests || !analytics || verification {
+		return 0, ErrNoHistory
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version > handMadeVersion {
+			break
+		}
+		if err := record(ctx, tx, mig); err != nil {
+			return 0, err
+		}
+	}
+	log.Printf("Found the hand-made schema; recorded it as migration %03d", handMadeVersion)
+	return handMadeVersion, nil
+}
@@ -0,0 +1,189 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikhilsahni7/typeMaster/backend/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"010_later.up.sql":    file("later"),
+				"002_second.up.sql":   file("second"),
+				"002_second.down.sql": file("undo second"),
+				"001_first.up.sql":    file("first"),
+			},
+			versions: []int{1, 2, 10},
+		},
+		{name: "bad name", fsys: fstest.MapFS{"first.up.sql": file("")}, err: "name must look like"},
+		{name: "no up file", fsys: fstest.MapFS{"001_first.down.sql": file("")}, err: "has no up file"},
+		{
+			name: "two names",
+			fsys: fstest.MapFS{"001_first.up.sql": file(""), "001_other.down.sql": file("")},
+			err:  "has two names",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := load(tt.fsys)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.versions) {
+				t.Fatalf("loaded %d migrations, want %d", len(got), len(tt.versions))
+			}
+			for i, mig := range got {
+				if mig.Version != tt.versions[i] {
+					t.Fatalf("migration %d is version %d, want %d", i, mig.Version, tt.versions[i])
+				}
+			}
+			if got[1].Down != "undo second" || got[0].Down != "" {
+				t.Fatalf("down files %q and %q, want only the second", got[0].Down, got[1].Down)
+			}
+		})
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	got, err := load(migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mig := range got {
+		if mig.Version != i+1 {
+			t.Fatalf("migration %d_%s follows %d; versions must not skip", mig.Version, mig.Name, i)
+		}
+		if mig.Down == "" {
+			t.Fatalf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+	}
+	if len(got) <= handMadeVersion {
+		t.Fatalf("%d migrations, want more than the %d hand-made ones", len(got), handMadeVersion)
+	}
+}
+
+// testDB connects to the database in TEST_DATABASE_URL and empties it. The
+// database is dropped and re-created, so it must be one kept for tests.
+func testDB(t *testing.T) *pgxpool.Pool {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.Exec(ctx, `DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpAdoptsHandMadeSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		by   int // Version the schema was set up to by hand, outside the versions table
+		err  error
+	}{
+		{name: "fresh", by: 0},
+		{name: "hand-made 001 to 003", by: handMadeVersion},
+		{name: "only 001", by: 1, err: ErrNoHistory},
+		{name: "past 003", by: handMadeVersion + 1, err: ErrNoHistory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := testDB(t)
+			m, err := New(db, migrations.Files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mig := range m.Migrations()[:tt.by] {
+				if _, err := db.Exec(ctx, mig.Up); err != nil {
+					t.Fatalf("setting up %d_%s by hand: %v", mig.Version, mig.Name, err)
+				}
+			}
+
+			applied, err := m.Up(ctx)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := m.Latest() - tt.by; len(applied) != want || applied[0].Version != tt.by+1 {
+				t.Fatalf("applied %d migrations from %d, want %d from %d", len(applied), applied[0].Version, want, tt.by+1)
+			}
+
+			history, err := m.History(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != m.Latest() {
+				t.Fatalf("%d migrations recorded, want %d", len(history), m.Latest())
+			}
+		})
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	m, err := New(db, migrations.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set up to 004 by hand, which Up refuses to guess at
+	for _, mig := range m.Migrations()[:handMadeVersion+1] {
+		if _, err := db.Exec(ctx, mig.Up); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Baseline(ctx, m.Latest()+1); err == nil {
+		t.Fatal("baselined past the latest migration")
+	}
+	if err := m.Baseline(ctx, handMadeVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Baseline(ctx, handMadeVersion+1); err == nil {
+		t.Fatal("baselined a database that already has history")
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != m.Latest()-handMadeVersion-1 {
+		t.Fatalf("applied %d migrations after the baseline, want %d", len(applied), m.Latest()-handMadeVersion-1)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Achievement is a milestone a user can unlock
+type Achievement struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Icon        string     `json:"icon"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"` // Unset while locked
+}
+
+// Progress is a user's XP, level and achievements
+type Progress struct {
+	UserID       string        `json:"user_id"`
+	XP           int64         `json:"xp"`
+	Level        int           `json:"level"`
+	LevelXP      int64         `json:"level_xp"`      // XP at which the current level began
+	NextLevelXP  int64         `json:"next_level_xp"` // XP needed for the next level
+	Achievements []Achievement `json:"achievements"`  // Every achievement, locked or not
+}
+
+// AchievementUnlockedPayload tells a player they unlocked an achievement
+type AchievementUnlockedPayload struct {
+	Achievement Achievement `json:"achievement"`
+	XP          int64       `json:"xp"`
+	Level       int         `json:"level"`
+}
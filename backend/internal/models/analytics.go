@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// KeyAnalytics merges the per-key errors of a user's matches. Error rates
+// only count matches that were replayed on the server, since only those
+// record how often each key came up; older results still add to Errors.
+type KeyAnalytics struct {
+	UserID  string     `json:"user_id"`
+	From    *time.Time `json:"from,omitempty"`
+	To      *time.Time `json:"to,omitempty"`
+	Matches int        `json:"matches"`
+
+	Keys         []KeyStat       `json:"keys"`          // Highest error rate first
+	WorstBigrams []KeyStat       `json:"worst_bigrams"` // Keyed by the two-character pair
+	Trend        []KeyTrendPoint `json:"trend"`         // Oldest first
+}
+
+// KeyStat is how often one key, or pair of keys, was mistyped
+type KeyStat struct {
+	Key       string   `json:"key"`
+	Errors    int      `json:"errors"`
+	Attempts  int      `json:"attempts"`
+	ErrorRate *float64 `json:"error_rate"` // 0-1, unset without attempts
+}
+
+// KeyTrendPoint is a week of key errors. Keys holds the week's error rate
+// for each of the user's worst keys overall.
+type KeyTrendPoint struct {
+	Week      string             `json:"week"` // Monday, YYYY-MM-DD, UTC
+	Errors    int                `json:"errors"`
+	Attempts  int                `json:"attempts"`
+	ErrorRate *float64           `json:"error_rate"`
+	Keys      map[string]float64 `json:"keys"`
+}
@@ -1,40 +1,297 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+)
 
 // EventType defines the type of message being sent/received
 type EventType string
 
+// Opening a connection: the client's hello must be its first message, and
+// the server answers with welcome
+const (
+	EventHello   EventType = "hello"
+	EventWelcome EventType = "welcome"
+)
+
+// Events sent by clients
 const (
 	EventJoinLobby    EventType = "join_lobby"
 	EventLeaveLobby   EventType = "leave_lobby"
 	EventChatMessage  EventType = "chat_message"
 	EventTypingUpdate EventType = "typing_update"
-	EventGameStart    EventType = "game_start"
 	EventGameEnd      EventType = "game_end"
+	EventPlayerReady  EventType = "player_ready" // Also sent by the server, as a PlayerPayload
+)
+
+// Events sent by the server. Clients only ever see events the server has
+// built itself, never another client's message.
+const (
+	EventPlayerJoined EventType = "player_joined"
+	EventPlayerLeft   EventType = "player_left"
+	EventProgress     EventType = "progress"
+	EventChat         EventType = "chat"
+	EventRaceResult   EventType = "race_result"
+	EventGameStart    EventType = "game_start"
+	EventGameResults  EventType = "game_results"
+	EventRaceState    EventType = "race_state"
 	EventError        EventType = "error"
+	EventSession      EventType = "session"
+
+	EventAchievementUnlocked EventType = "achievement_unlocked"
+)
+
+// ErrorCode says why the server refused a client's event
+type ErrorCode string
+
+const (
+	CodeBadMessage     ErrorCode = "bad_message"     // Not a JSON event
+	CodeUnknownEvent   ErrorCode = "unknown_event"   // No such event type
+	CodeInvalidPayload ErrorCode = "invalid_payload" // Payload failed to parse or validate
+	CodeNotInRoom      ErrorCode = "not_in_room"     // The event needs a room to be joined first
+	CodeRejected       ErrorCode = "result_rejected" // A game_end the keystroke log contradicts
+	CodeInternal       ErrorCode = "internal_error"
 )
 
 // WSEvent is the standard wrapper for all WebSocket messages
 type WSEvent struct {
 	Type    EventType       `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+
+	// Seq numbers the events the server sends a client, from 1, so that a
+	// reconnecting client can ask for the ones it missed. Unset on events
+	// from clients and on the session event.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// SessionPayload is the first event on every connection. A client that
+// drops can reconnect with ?resume=<token>&last_seq=<seq> within the resume
+// window to get back the events it missed and its place in its room. If
+// Resumed is false, as after reconnecting to another instance, the client
+// should join its room again, which sends it the race's current state.
+type SessionPayload struct {
+	Token   string `json:"token"`
+	Resumed bool   `json:"resumed"`
+	RoomID  string `json:"room_id,omitempty"` // The room the client is back in
+	Seq     uint64 `json:"seq"`               // Last event sent so far, replays included
+	// Replayed is how many missed events follow. Complete is false when
+	// some were too old to be kept, and the client should treat its state
+	// as stale.
+	Replayed int  `json:"replayed"`
+	Complete bool `json:"complete"`
+}
+
+// HelloPayload opens a connection. Version is the newest protocol version
+// the client speaks; Features lists optional behaviour it understands.
+type HelloPayload struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
 }
 
-// TypingPayload carries real-time game stats
+// WelcomePayload accepts a connection, with the protocol version both sides
+// will use and the features the server will use with this client.
+type WelcomePayload struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+}
+
+// JoinLobbyPayload asks to join a room, leaving any other
+type JoinLobbyPayload struct {
+	RoomID string `json:"room_id"`
+}
+
+// TypingPayload carries a racer's real-time stats
 type TypingPayload struct {
-	UserID   string  `json:"user_id"`
+	WPM      int     `json:"wpm"`
+	Accuracy float64 `json:"accuracy"`
+	Progress int     `json:"progress"` // 0-100%
+}
+
+// ChatMessagePayload is a chat message from a client
+type ChatMessagePayload struct {
+	Message string `json:"message"`
+}
+
+// LeaveLobbyPayload and PlayerReadyPayload carry nothing; the event is the
+// message
+type (
+	LeaveLobbyPayload  struct{}
+	PlayerReadyPayload struct{}
+)
+
+// GameEndPayload is a finished game as the client reports it. The server
+// recomputes the stats from the keystrokes, replayed on the passage it
+// issued, which Passage must name. Mode and Language are ignored in favour of
+// the issued test's, and Duration, the time the test ran, may not exceed the
+// time it allows.
+type GameEndPayload struct {
+	WPM               int     `json:"wpm"`
+	RawWPM            int     `json:"raw_wpm"`
+	Accuracy          float64 `json:"accuracy"`
+	Consistency       float64 `json:"consistency"`
+	ErrorCount        int     `json:"error_count"`
+	Mode              string  `json:"mode"`
+	Language          string  `json:"language"`
+	Duration          int     `json:"duration"`
+	BadKeys           any     `json:"bad_keys"`
+	ImprovementNeeded string  `json:"improvement_needed"`
+
+	// The passage that was typed and the keystrokes that typed it, used
+	// to recompute the stats above.
+	Passage    *passage.Spec         `json:"passage"`
+	Keystrokes []anticheat.Keystroke `json:"keystrokes"`
+}
+
+// PlayerPayload names the player a player_joined, player_left or
+// player_ready event is about
+type PlayerPayload struct {
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// ProgressPayload relays a racer's real-time stats to their room
+type ProgressPayload struct {
 	RoomID   string  `json:"room_id"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
 	WPM      int     `json:"wpm"`
 	Accuracy float64 `json:"accuracy"`
 	Progress int     `json:"progress"` // 0-100%
 }
 
-// ChatPayload carries chat messages
+// ChatPayload relays a chat message to its room
 type ChatPayload struct {
-	UserID  string `json:"user_id"`
-	RoomID  string `json:"room_id"`
-	Message string `json:"message"`
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Message  string `json:"message"`
+	SentAt   int64  `json:"sent_at"` // Unix milliseconds
+}
+
+// RaceResultPayload announces a racer's result once the server has checked
+// it. The numbers are the server's, recomputed from the keystroke log when
+// there is one.
+type RaceResultPayload struct {
+	RoomID       string  `json:"room_id"`
+	UserID       string  `json:"user_id"`
+	Username     string  `json:"username"`
+	WPM          int     `json:"wpm"`
+	Accuracy     float64 `json:"accuracy"`
+	Verification string  `json:"verification"`
+}
+
+// ErrorPayload tells a client why one of its events was refused
+type ErrorPayload struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Event   EventType `json:"event,omitempty"` // The event refused, when known
+}
+
+// GameStartPayload announces a race. Every racer in the room starts typing the
+// same passage at StartAt.
+type GameStartPayload struct {
+	RoomID    string       `json:"room_id"`
+	Passage   passage.Spec `json:"passage"`
+	Text      string       `json:"text"`
+	StartAt   int64        `json:"start_at"`   // Unix milliseconds
+	TimeLimit int          `json:"time_limit"` // Seconds
+}
+
+// RaceStanding is a single racer's placing in the final results
+type RaceStanding struct {
+	Rank     int     `json:"rank"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	WPM      int     `json:"wpm"`
+	Accuracy float64 `json:"accuracy"`
+	Progress int     `json:"progress"`
+	Finished bool    `json:"finished"`
+	Time     int64   `json:"time_ms"` // Time taken from the start, 0 if unfinished
+	// Finished with a result its keystrokes could not back up. Unranked
+	// finishers come last with a rank of 0.
+	Unranked bool `json:"unranked,omitempty"`
+}
+
+// GameResultsPayload carries the final standings of a race
+type GameResultsPayload struct {
+	RoomID    string         `json:"room_id"`
+	Standings []RaceStanding `json:"standings"`
+}
+
+// RaceParticipant is a room member's standing in the current race
+type RaceParticipant struct {
+	UserID     string  `json:"user_id"`
+	Username   string  `json:"username"`
+	Ready      bool    `json:"ready"`
+	Racing     bool    `json:"racing"`
+	Finished   bool    `json:"finished"`
+	WPM        int     `json:"wpm"`
+	Accuracy   float64 `json:"accuracy"`
+	Progress   int     `json:"progress"`
+	FinishedAt int64   `json:"finished_at,omitempty"` // Unix milliseconds
+	Unranked   bool    `json:"unranked,omitempty"`
+}
+
+// RaceSnapshot is the authoritative state of a room's race, saved so that
+// another instance can take the room over and reconnecting clients can
+// resume. The passage is stored as its spec, which regenerates the text.
+type RaceSnapshot struct {
+	RoomID       string            `json:"room_id"`
+	State        string            `json:"state"`
+	Round        int               `json:"round"`
+	Passage      passage.Spec      `json:"passage"`
+	StartAt      int64             `json:"start_at,omitempty"` // Unix milliseconds
+	TimeLimit    int               `json:"time_limit"`         // Seconds
+	Participants []RaceParticipant `json:"participants"`
+}
+
+// RaceStatePayload brings a client joining or rejoining a room mid-race up to
+// date: the passage, when the race started, and everyone's progress so far.
+type RaceStatePayload struct {
+	RoomID       string            `json:"room_id"`
+	State        string            `json:"state"`
+	Passage      passage.Spec      `json:"passage"`
+	Text         string            `json:"text"`
+	StartAt      int64             `json:"start_at"`   // Unix milliseconds
+	TimeLimit    int               `json:"time_limit"` // Seconds
+	Participants []RaceParticipant `json:"participants"`
+}
+
+// Modes the server records results under, besides timed tests, which are
+// time_<seconds>
+const (
+	// ModePractice is the mode of a drill passage weighted toward a user's
+	// weak keys.
+	ModePractice = "practice"
+	// ModeRace is the mode of a result typed in a room's race.
+	ModeRace = "race"
+	// ModeWords is the mode of an untimed test, typed to the end of its
+	// passage.
+	ModeWords = "words"
+)
+
+// TimedMode returns the mode of a timed test of the given length
+func TimedMode(seconds int) string {
+	return "time_" + strconv.Itoa(seconds)
+}
+
+// IssuedTest is a test the server set a player: the passage to type and what
+// a result on it counts as. Results are recorded under its mode, language and
+// length, whatever the client reports.
+type IssuedTest struct {
+	Passage  passage.Spec `json:"passage"`
+	Mode     string       `json:"mode"`
+	Language string       `json:"language"`
+	Duration int          `json:"duration,omitempty"` // Seconds allowed; 0 if untimed
+	// When the test could first be typed: when a race started, or when a solo
+	// passage was issued. No result can have taken longer than the time since.
+	Start time.Time `json:"start"`
 }
 
 // MatchResult represents the final stats of a completed game
@@ -52,4 +309,12 @@ type MatchResult struct {
 	CreatedAt         string  `json:"created_at"`
 	BadKeys           string  `json:"bad_keys"`           // JSON string
 	ImprovementNeeded string  `json:"improvement_needed"` // Text description
+	Verification      string  `json:"verification"`       // Anti-cheat verdict
+	FlagReasons       string  `json:"flag_reasons,omitempty"`
+
+	// Per-key and per-bigram counts from the keystroke replay, as JSON
+	// strings. Empty for unverified results.
+	KeyCounts    string `json:"-"`
+	BigramCounts string `json:"-"`
+	BadBigrams   string `json:"-"`
 }
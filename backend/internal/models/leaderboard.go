@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is assumed for results that do not name a language
+const DefaultLanguage = "english"
+
+// BoardDurations are the test lengths, in seconds, that have leaderboards
+var BoardDurations = []int{15, 30, 60, 120}
+
+var boardNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Board identifies one leaderboard. Results are only ranked against others
+// with the same mode, language and test length.
+type Board struct {
+	Mode     string `json:"mode"`
+	Language string `json:"language"`
+	Duration int    `json:"duration"` // Seconds
+}
+
+// NewBoard normalizes and validates a board's fields
+func NewBoard(mode, language string, duration int) (Board, error) {
+	b := Board{
+		Mode:     strings.ToLower(strings.TrimSpace(mode)),
+		Language: strings.ToLower(strings.TrimSpace(language)),
+		Duration: duration,
+	}
+	if b.Language == "" {
+		b.Language = DefaultLanguage
+	}
+
+	if !boardNamePattern.MatchString(b.Mode) {
+		return Board{}, errors.New("invalid mode")
+	}
+	if !boardNamePattern.MatchString(b.Language) {
+		return Board{}, errors.New("invalid language")
+	}
+	if !slices.Contains(BoardDurations, b.Duration) {
+		return Board{}, fmt.Errorf("duration must be one of %v", BoardDurations)
+	}
+	return b, nil
+}
+
+// BoardForMatch returns the board a result is ranked on. Only timed tests are
+// ranked, for the length that was set, which their mode names as
+// time_<seconds>; one that ended early, by finishing the passage, still
+// counts for that length. Practice drills are tailored to the player and
+// races are ranked among their racers, so neither is on a board.
+func BoardForMatch(m *MatchResult) (Board, error) {
+	s, ok := strings.CutPrefix(m.Mode, "time_")
+	if !ok {
+		return Board{}, fmt.Errorf("%s results are not ranked", m.Mode)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return Board{}, fmt.Errorf("invalid mode %q", m.Mode)
+	}
+	if m.Duration > n {
+		return Board{}, fmt.Errorf("a %d second result cannot count for %s", m.Duration, m.Mode)
+	}
+	return NewBoard(m.Mode, m.Language, n)
+}
+
+// LeaderboardEntry is a user's placing on a board
+type LeaderboardEntry struct {
+	Rank       int64     `json:"rank"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	WPM        int       `json:"wpm"`
+	MatchID    string    `json:"match_id"`    // The match that set the score
+	AchievedAt time.Time `json:"achieved_at"` // When that match was played
+}
+
+// LeaderboardPage is a slice of a board, ranked from the top
+type LeaderboardPage struct {
+	Board   Board              `json:"board"`
+	Period  Period             `json:"period"`
+	Start   *time.Time         `json:"period_start,omitempty"` // Unset for AllTime
+	Total   int64              `json:"total"`
+	Offset  int64              `json:"offset"`
+	Entries []LeaderboardEntry `json:"entries"`
+	// The requesting user's own placing, if they are on the board.
+	Me *LeaderboardEntry `json:"me,omitempty"`
+}
+
+// Period is the time window a board covers. Boards other than AllTime start
+// afresh at the beginning of each period, in UTC.
+type Period string
+
+const (
+	AllTime Period = "all_time"
+	Daily   Period = "daily"
+	Weekly  Period = "weekly" // Starting on Monday
+	Monthly Period = "monthly"
+)
+
+// Periods lists every window a result is ranked in
+var Periods = []Period{AllTime, Daily, Weekly, Monthly}
+
+// ParsePeriod validates a period name. An empty name means AllTime.
+func ParsePeriod(s string) (Period, error) {
+	if s == "" {
+		return AllTime, nil
+	}
+	p := Period(s)
+	if !slices.Contains(Periods, p) {
+		return "", fmt.Errorf("period must be one of %v", Periods)
+	}
+	return p, nil
+}
+
+// Start returns the beginning of the period containing t. AllTime has no
+// start and returns the zero time.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case Daily:
+		return day
+	case Weekly:
+		// Weekday counts from Sunday; shift so Monday is 0.
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// Next returns the start of the period after the one beginning at start
+func (p Period) Next(start time.Time) time.Time {
+	switch p {
+	case Daily:
+		return start.AddDate(0, 0, 1)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// ArchivedEntry is a placing on a board for a period that has ended
+type ArchivedEntry struct {
+	LeaderboardEntry
+	Period      Period    `json:"period"`
+	PeriodStart time.Time `json:"period_start"`
+	Board       Board     `json:"board"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// MatchSort is the order a match listing is returned in
+type MatchSort string
+
+const (
+	SortNewest  MatchSort = "newest"
+	SortOldest  MatchSort = "oldest"
+	SortFastest MatchSort = "fastest" // Highest WPM first, newest first among ties
+)
+
+// MatchFilter selects a page of one user's matches. Zero-valued fields do
+// not filter.
+type MatchFilter struct {
+	UserID      string
+	Mode        string
+	Language    string
+	MinDuration int
+	MaxDuration int
+	MinWPM      int
+	MaxWPM      int
+	From        time.Time // Inclusive
+	To          time.Time // Exclusive
+	Sort        MatchSort
+	// Cursor is the ID of the last match on the previous page.
+	Cursor string
+	Limit  int
+}
+
+// IsDefault reports whether the filter asks for nothing but the first page
+// of a user's newest matches, of any length.
+func (f MatchFilter) IsDefault() bool {
+	return f == MatchFilter{UserID: f.UserID, Sort: SortNewest, Limit: f.Limit}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// UserStats are a user's lifetime figures, aggregated over every saved match
+type UserStats struct {
+	UserID           string     `json:"user_id"`
+	TotalMatches     int        `json:"total_matches"`
+	AvgWPM           float64    `json:"avg_wpm"`
+	MaxWPM           int        `json:"max_wpm"` // Of verified matches only
+	AvgAccuracy      float64    `json:"avg_accuracy"`
+	TotalTimeSeconds int        `json:"total_time_seconds"`
+	FirstMatchAt     *time.Time `json:"first_match_at"`
+	LastMatchAt      *time.Time `json:"last_match_at"`
+
+	PersonalBests []PersonalBest `json:"personal_bests"`
+	Trend         []TrendPoint   `json:"trend"` // Oldest first
+	Streak        Streak         `json:"streak"`
+}
+
+// PersonalBest is a user's fastest verified match in one mode and test
+// length. Results the server could not verify, or flagged, are left out.
+type PersonalBest struct {
+	Mode       string    `json:"mode"`
+	Duration   int       `json:"duration"`
+	WPM        int       `json:"wpm"`
+	Accuracy   float64   `json:"accuracy"`
+	MatchID    string    `json:"match_id"`
+	AchievedAt time.Time `json:"achieved_at"`
+}
+
+// TrendPoint averages one day of matches
+type TrendPoint struct {
+	Date        string  `json:"date"` // YYYY-MM-DD, UTC
+	Matches     int     `json:"matches"`
+	AvgWPM      float64 `json:"avg_wpm"`
+	AvgAccuracy float64 `json:"avg_accuracy"`
+}
+
+// Streak counts consecutive UTC days with at least one match. The current
+// streak is still alive if the user has played today or yesterday.
+type Streak struct {
+	Current    int    `json:"current"`
+	Longest    int    `json:"longest"`
+	LastActive string `json:"last_active,omitempty"` // YYYY-MM-DD, UTC
+}
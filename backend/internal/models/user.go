@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// User is a player account. Guests have no email or password until they
+// register.
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email,omitempty"`
+	IsGuest   bool      `json:"is_guest"`
+	CreatedAt time.Time `json:"created_at"`
+}
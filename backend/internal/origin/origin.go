@@ -0,0 +1,152 @@
+// Package origin matches request origins against an allow-list.
+package origin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Policy is a compiled list of allowed origins
+type Policy struct {
+	any      bool
+	patterns []pattern
+}
+
+// pattern is one allowed origin. A host of "*.example.com" matches any
+// subdomain of example.com but not example.com itself, and a port of "*"
+// matches any port.
+type pattern struct {
+	scheme string
+	host   string // Without the leading "*." for wildcard hosts
+	sub    bool
+	port   string // Empty for the scheme's default port
+}
+
+// NewPolicy compiles patterns such as "https://typemaster.app",
+// "https://*.typemaster.app" and "http://localhost:*". A lone "*" allows
+// every origin.
+func NewPolicy(patterns []string) (*Policy, error) {
+	p := &Policy{}
+	var errs []error
+	for _, raw := range patterns {
+		if raw == "*" {
+			p.any = true
+			continue
+		}
+		pat, err := parse(raw)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.patterns = append(p.patterns, pat)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+func parse(raw string) (pattern, error) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(raw), "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return pattern{}, fmt.Errorf("origin %q must start with http:// or https://", raw)
+	}
+	if rest == "" || strings.ContainsAny(rest, "/?#@") {
+		return pattern{}, fmt.Errorf("origin %q must be a scheme and host with no path", raw)
+	}
+
+	host, port := rest, ""
+	if h, p, err := net.SplitHostPort(rest); err == nil {
+		host, port = h, p
+	}
+	host = strings.Trim(host, "[]")
+	if port != "" && port != "*" && !isDigits(port) {
+		return pattern{}, fmt.Errorf("origin %q has an invalid port", raw)
+	}
+	if port == defaultPort(scheme) {
+		port = ""
+	}
+
+	pat := pattern{scheme: scheme, host: host, port: port}
+	if strings.HasPrefix(host, "*.") {
+		pat.sub, pat.host = true, host[2:]
+	}
+	if pat.host == "" || strings.Contains(pat.host, "*") {
+		return pattern{}, fmt.Errorf("origin %q may only use * as the first label of the host or as the port", raw)
+	}
+	return pat, nil
+}
+
+// Any reports whether every origin is allowed
+func (p *Policy) Any() bool {
+	return p.any
+}
+
+// LocalOnly reports whether the list allows nothing but pages on the local
+// machine, as the development defaults do
+func (p *Policy) LocalOnly() bool {
+	if p.any {
+		return false
+	}
+	for _, pat := range p.patterns {
+		if pat.sub || (pat.host != "localhost" && pat.host != "127.0.0.1" && pat.host != "::1") {
+			return false
+		}
+	}
+	return true
+}
+
+// Allowed reports whether an Origin header value is on the list
+func (p *Policy) Allowed(origin string) bool {
+	if p.any {
+		return true
+	}
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == defaultPort(u.Scheme) {
+		port = ""
+	}
+
+	for _, pat := range p.patterns {
+		if pat.scheme != u.Scheme {
+			continue
+		}
+		if pat.port != "*" && pat.port != port {
+			continue
+		}
+		if pat.sub && strings.HasSuffix(host, "."+pat.host) || !pat.sub && host == pat.host {
+			return true
+		}
+	}
+	return false
+}
+
+// SameOrigin reports whether a request's Origin names the host it was sent
+// to, as a page served by this backend, or by a proxy in front of it, would
+func SameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,123 @@
+package origin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	policy, err := NewPolicy([]string{"https://typemaster.app", "https://*.typemaster.app", "http://localhost:*", "http://[::1]:5173"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://typemaster.app", true},
+		{"https://typemaster.app:443", true},
+		{"HTTPS://TypeMaster.App", true},
+		{"https://www.typemaster.app", true},
+		{"https://a.b.typemaster.app", true},
+		{"http://localhost:5173", true},
+		{"http://localhost", true},
+		{"http://[::1]:5173", true},
+
+		{"http://typemaster.app", false},
+		{"https://typemaster.app:8443", false},
+		{"https://eviltypemaster.app", false},
+		{"https://typemaster.app.evil.com", false},
+		{"https://localhost:5173", false},
+		{"http://[::1]:3000", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(tt.origin); got != tt.allowed {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	policy, err := NewPolicy([]string{"*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Any() || !policy.Allowed("https://anywhere.example") {
+		t.Fatal("* does not allow every origin")
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     string
+	}{
+		{"typemaster.app", "must start with http:// or https://"},
+		{"ftp://typemaster.app", "must start with http:// or https://"},
+		{"https://typemaster.app/", "no path"},
+		{"https://user@typemaster.app", "no path"},
+		{"https://", "no path"},
+		{"https://typemaster.app:https", "invalid port"},
+		{"https://www.*.typemaster.app", "may only use *"},
+		{"https://*", "may only use *"},
+	}
+	for _, tt := range tests {
+		_, err := NewPolicy([]string{"https://typemaster.app", tt.pattern})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("NewPolicy(%q): got %v, want an error mentioning %q", tt.pattern, err, tt.err)
+		}
+	}
+
+	// Every bad pattern is reported, not just the first
+	_, err := NewPolicy([]string{"typemaster.app", "https://typemaster.app/"})
+	if err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Fatalf("got %v, want two errors", err)
+	}
+}
+
+func TestLocalOnly(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		local    bool
+	}{
+		{[]string{"http://localhost:5173", "http://127.0.0.1:5173"}, true},
+		{[]string{"http://localhost:*", "http://[::1]:5173"}, true},
+		{nil, true},
+		{[]string{"http://localhost:5173", "https://typemaster.app"}, false},
+		{[]string{"https://*.localhost"}, false},
+		{[]string{"*"}, false},
+	}
+	for _, tt := range tests {
+		policy, err := NewPolicy(tt.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := policy.LocalOnly(); got != tt.local {
+			t.Errorf("LocalOnly(%q) = %v, want %v", tt.patterns, got, tt.local)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		same   bool
+	}{
+		{"https://api.typemaster.app", true},
+		{"http://API.typemaster.app", true}, // The scheme is not compared, as TLS may end at a proxy
+		{"https://typemaster.app", false},
+		{"https://api.typemaster.app:8443", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "https://api.typemaster.app/api/history", nil)
+		r.Header.Set("Origin", tt.origin)
+		if got := SameOrigin(r); got != tt.same {
+			t.Errorf("SameOrigin(%q) = %v, want %v", tt.origin, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package passage
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Difficulty selects the word pool a passage is drawn from
+type Difficulty string
+
+const (
+	Easy   Difficulty = "easy"
+	Medium Difficulty = "medium"
+	Hard   Difficulty = "hard"
+)
+
+const (
+	DefaultWords = 100
+	MaxWords     = 500
+
+	// MaxFocus caps how many keys and bigrams a passage can be weighted toward.
+	MaxFocus = 10
+
+	// Each focus key or bigram a word contains makes it this many times more
+	// likely to be picked.
+	focusBoost = 4
+
+	// Seeds stay below 2^53 so they survive a round trip through JavaScript.
+	maxSeed = 1 << 53
+)
+
+// Spec fully describes a passage. The same spec always produces the same text,
+// on every instance, so it can be sent to clients and used for verification
+// instead of the text itself.
+type Spec struct {
+	Seed       int64      `json:"seed"`
+	Difficulty Difficulty `json:"difficulty"`
+	Words      int        `json:"words"`
+	// Focus lists keys and bigrams to weight the passage toward, for
+	// practice drills. Empty for an ordinary passage.
+	Focus []string `json:"focus,omitempty"`
+}
+
+// ParseDifficulty validates a difficulty name, defaulting to Medium when empty
+func ParseDifficulty(s string) (Difficulty, error) {
+	switch d := Difficulty(s); d {
+	case "":
+		return Medium, nil
+	case Easy, Medium, Hard:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown difficulty %q", s)
+	}
+}
+
+// NewSpec returns a spec with a fresh random seed
+func NewSpec(difficulty Difficulty, words int) Spec {
+	return Spec{
+		Seed:       rand.Int64N(maxSeed),
+		Difficulty: difficulty,
+		Words:      words,
+	}
+}
+
+// WordsFor returns how many words a passage needs so that a typist at wpm
+// does not run out of text within the given number of seconds, up to
+// MaxWords.
+func WordsFor(seconds, wpm int) int {
+	return min(max((seconds*wpm+59)/60, 1), MaxWords)
+}
+
+// Validate checks that the spec can be generated
+func (s Spec) Validate() error {
+	if _, ok := corpora[s.Difficulty]; !ok {
+		return fmt.Errorf("unknown difficulty %q", s.Difficulty)
+	}
+	if s.Words < 1 || s.Words > MaxWords {
+		return fmt.Errorf("words must be between 1 and %d", MaxWords)
+	}
+	if s.Seed < 0 || s.Seed >= maxSeed {
+		return fmt.Errorf("seed must be between 0 and %d", int64(maxSeed-1))
+	}
+	if len(s.Focus) > MaxFocus {
+		return fmt.Errorf("at most %d focus keys are allowed", MaxFocus)
+	}
+	for _, f := range s.Focus {
+		if n := utf8.RuneCountInString(f); n < 1 || n > 2 {
+			return fmt.Errorf("focus %q must be a key or a bigram", f)
+		}
+	}
+	return nil
+}
+
+// Text generates the passage for the spec. Words never repeat back to back.
+func (s Spec) Text() string {
+	words := pool(s.Difficulty)
+	if len(words) == 0 || s.Words < 1 {
+		return ""
+	}
+
+	// PCG is fully specified, so its output does not depend on the Go version.
+	rng := rand.New(rand.NewPCG(uint64(s.Seed), 0))
+	pick := func() string { return words[rng.IntN(len(words))] }
+	if len(s.Focus) > 0 {
+		pick = weightedPicker(rng, words, s.Focus)
+	}
+
+	out := make([]string, 0, s.Words)
+	last := ""
+	for i := 0; i < s.Words; i++ {
+		word := pick()
+		for word == last {
+			word = pick()
+		}
+		out = append(out, word)
+		last = word
+	}
+	return strings.Join(out, " ")
+}
+
+// weightedPicker draws words in proportion to how many of the focus keys and
+// bigrams they contain.
+func weightedPicker(rng *rand.Rand, words, focus []string) func() string {
+	cumulative := make([]int, len(words))
+	total := 0
+	for i, w := range words {
+		weight := 1
+		for _, f := range focus {
+			if strings.Contains(w, f) {
+				weight += focusBoost
+			}
+		}
+		total += weight
+		cumulative[i] = total
+	}
+
+	return func() string {
+		n := rng.IntN(total)
+		i := sort.SearchInts(cumulative, n+1)
+		return words[i]
+	}
+}
@@ -0,0 +1,72 @@
+package passage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextDeterministic(t *testing.T) {
+	specs := []Spec{
+		{Seed: 42, Difficulty: Easy, Words: 50},
+		{Seed: 42, Difficulty: Medium, Words: DefaultWords},
+		{Seed: maxSeed - 1, Difficulty: Hard, Words: MaxWords},
+		{Seed: 7, Difficulty: Medium, Words: 80, Focus: []string{"q", "th"}},
+	}
+	for _, spec := range specs {
+		text := spec.Text()
+		if got := len(strings.Fields(text)); got != spec.Words {
+			t.Fatalf("%+v: %d words, want %d", spec, got, spec.Words)
+		}
+		for i := 0; i < 3; i++ {
+			if again := spec.Text(); again != text {
+				t.Fatalf("%+v: generated different text on a later call", spec)
+			}
+		}
+	}
+}
+
+func TestTextDependsOnSpec(t *testing.T) {
+	base := Spec{Seed: 42, Difficulty: Medium, Words: DefaultWords}
+	text := base.Text()
+
+	for _, seed := range []int64{0, 1, 43, maxSeed - 1} {
+		other := base
+		other.Seed = seed
+		if other.Text() == text {
+			t.Fatalf("seeds %d and %d generated the same text", base.Seed, seed)
+		}
+	}
+
+	hard := base
+	hard.Difficulty = Hard
+	if hard.Text() == text {
+		t.Fatal("medium and hard generated the same text")
+	}
+
+	// A longer passage from the same seed starts the same way
+	longer := base
+	longer.Words = base.Words * 2
+	if !strings.HasPrefix(longer.Text(), text+" ") {
+		t.Fatal("a longer passage does not extend the shorter one")
+	}
+}
+
+// TestTextStable pins the output for one spec, so that a change to the
+// generator or its word lists, which would make every passage already issued
+// fail verification, does not go unnoticed.
+func TestTextStable(t *testing.T) {
+	spec := Spec{Seed: 1, Difficulty: Easy, Words: 8}
+	const want = "just have them to could can its no"
+	if got := spec.Text(); got != want {
+		t.Fatalf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestNoRepeats(t *testing.T) {
+	words := strings.Fields(Spec{Seed: 9, Difficulty: Easy, Words: MaxWords}.Text())
+	for i := 1; i < len(words); i++ {
+		if words[i] == words[i-1] {
+			t.Fatalf("%q repeated at word %d", words[i], i)
+		}
+	}
+}
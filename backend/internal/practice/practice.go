@@ -0,0 +1,78 @@
+package practice
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+const (
+	// Only recent matches count, so drills move on as the user improves.
+	window = 30 * 24 * time.Hour
+
+	maxKeys    = 5
+	maxBigrams = 3
+)
+
+// Drilled when a user has no key errors on record yet: the letters that turn
+// up least often in everyday typing.
+var defaultFocus = []string{"q", "z", "x", "j", "k"}
+
+// Service builds practice passages from a user's weak keys
+type Service struct {
+	matchRepo repository.MatchStore
+}
+
+func NewService(matchRepo repository.MatchStore) *Service {
+	return &Service{matchRepo: matchRepo}
+}
+
+// NewSpec returns a passage spec weighted toward the keys and bigrams the
+// user has been missing most
+func (s *Service) NewSpec(ctx context.Context, userID string, difficulty passage.Difficulty, words int) (passage.Spec, error) {
+	since := time.Now().Add(-window)
+	analytics, err := s.matchRepo.GetKeyAnalytics(ctx, userID, &since, nil)
+	if err != nil {
+		return passage.Spec{}, err
+	}
+
+	spec := passage.NewSpec(difficulty, words)
+	spec.Focus = FocusFor(analytics)
+	return spec, nil
+}
+
+// FocusFor picks the worst keys and bigrams from a user's analytics. Keys are
+// already ordered worst first. Whitespace is left out, since the word lists
+// cannot be weighted toward it.
+func FocusFor(a *models.KeyAnalytics) []string {
+	var focus []string
+	seen := make(map[string]bool)
+	add := func(s string, limit int, n *int) {
+		s = strings.ToLower(s)
+		if *n >= limit || seen[s] || strings.TrimSpace(s) != s || s == "" {
+			return
+		}
+		seen[s] = true
+		focus = append(focus, s)
+		*n++
+	}
+
+	var keys, bigrams int
+	for _, k := range a.Keys {
+		if k.Errors > 0 {
+			add(k.Key, maxKeys, &keys)
+		}
+	}
+	for _, b := range a.WorstBigrams {
+		add(b.Key, maxBigrams, &bigrams)
+	}
+
+	if len(focus) == 0 {
+		return defaultFocus
+	}
+	return focus
+}
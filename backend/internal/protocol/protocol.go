@@ -0,0 +1,110 @@
+// Package protocol defines the versions of the WebSocket protocol the server
+// speaks and decodes client events according to the version in use.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// Protocol versions. A change that older clients would misread gets a new
+// version with its own decoders, so that clients still on an older version
+// keep working until it is no longer supported.
+const (
+	Version1 = 1
+
+	// Current is the newest version the server speaks, and MinSupported the
+	// oldest it still accepts.
+	Current      = Version1
+	MinSupported = Version1
+)
+
+// Optional behaviour a client can ask for in its hello
+const (
+	// The server sends a session event and lets the client resume after a
+	// drop.
+	FeatureResume = "resume"
+	// The server replies to refused events with error events.
+	FeatureErrors = "errors"
+)
+
+// features are those the server offers, in the order it reports them.
+var features = []string{FeatureResume, FeatureErrors}
+
+// EventError is a client event the server refuses, with the code to send
+// back to the client
+type EventError struct {
+	Code    models.ErrorCode
+	Message string
+}
+
+func (e *EventError) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Invalid reports a payload that failed to validate.
+func Invalid(format string, args ...any) *EventError {
+	return &EventError{Code: models.CodeInvalidPayload, Message: fmt.Sprintf(format, args...)}
+}
+
+// Negotiate answers a client's hello, picking the newest version both sides
+// speak and the features both understand. A client too old for the server
+// gets an error meant to be shown to its user as the close reason.
+func Negotiate(hello models.HelloPayload) (models.WelcomePayload, error) {
+	if hello.Version < MinSupported {
+		return models.WelcomePayload{}, fmt.Errorf("protocol version %d is no longer supported; reload the page", hello.Version)
+	}
+
+	welcome := models.WelcomePayload{Version: min(hello.Version, Current), Features: []string{}}
+	for _, f := range features {
+		if slices.Contains(hello.Features, f) {
+			welcome.Features = append(welcome.Features, f)
+		}
+	}
+	return welcome, nil
+}
+
+// decoder turns an event's payload into its typed form.
+type decoder func(payload json.RawMessage) (any, error)
+
+// decoders holds, for each supported version, how to read every event a
+// client may send.
+var decoders = map[int]map[models.EventType]decoder{
+	Version1: {
+		models.EventJoinLobby:    decodeAs[models.JoinLobbyPayload],
+		models.EventLeaveLobby:   decodeEmpty[models.LeaveLobbyPayload],
+		models.EventPlayerReady:  decodeEmpty[models.PlayerReadyPayload],
+		models.EventTypingUpdate: decodeAs[models.TypingPayload],
+		models.EventChatMessage:  decodeAs[models.ChatMessagePayload],
+		models.EventGameEnd:      decodeAs[models.GameEndPayload],
+	},
+}
+
+// Decode reads a client event as the given protocol version defines it,
+// returning a pointer to its payload struct from package models.
+func Decode(version int, event models.WSEvent) (any, error) {
+	decode, ok := decoders[version][event.Type]
+	if !ok {
+		return nil, &EventError{Code: models.CodeUnknownEvent, Message: fmt.Sprintf("unknown event type %q", event.Type)}
+	}
+	return decode(event.Payload)
+}
+
+func decodeAs[T any](payload json.RawMessage) (any, error) {
+	if len(payload) == 0 || string(payload) == "null" {
+		return nil, Invalid("missing payload")
+	}
+	p := new(T)
+	if err := json.Unmarshal(payload, p); err != nil {
+		return nil, Invalid("malformed payload: %v", err)
+	}
+	return p, nil
+}
+
+// decodeEmpty is for events whose payload carries nothing and may be left out.
+func decodeEmpty[T any](json.RawMessage) (any, error) {
+	return new(T), nil
+}
@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		hello    models.HelloPayload
+		version  int
+		features []string
+		err      string
+	}{
+		{
+			name:     "current",
+			hello:    models.HelloPayload{Version: Current, Features: []string{FeatureErrors, FeatureResume}},
+			version:  Current,
+			features: []string{FeatureResume, FeatureErrors},
+		},
+		{
+			name:     "newer client",
+			hello:    models.HelloPayload{Version: Current + 1, Features: []string{FeatureErrors}},
+			version:  Current,
+			features: []string{FeatureErrors},
+		},
+		{
+			name:     "unknown features",
+			hello:    models.HelloPayload{Version: Current, Features: []string{"telepathy", FeatureResume}},
+			version:  Current,
+			features: []string{FeatureResume},
+		},
+		{name: "no features", hello: models.HelloPayload{Version: Current}, version: Current, features: []string{}},
+		{name: "too old", hello: models.HelloPayload{Version: MinSupported - 1}, err: "no longer supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			welcome, err := Negotiate(tt.hello)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if welcome.Version != tt.version || fmt.Sprint(welcome.Features) != fmt.Sprint(tt.features) {
+				t.Fatalf("welcome %+v, want version %d with %v", welcome, tt.version, tt.features)
+			}
+			// Sent as [] rather than null, so clients need not check
+			if data, _ := json.Marshal(welcome); !strings.Contains(string(data), `"features":[`) {
+				t.Fatalf("welcome encoded as %s", data)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		event   models.WSEvent
+		want    any
+		code    models.ErrorCode
+	}{
+		{
+			name:    "join_lobby",
+			version: Current,
+			event:   models.WSEvent{Type: models.EventJoinLobby, Payload: json.RawMessage(`{"room_id":"r1"}`)},
+			want:    &models.JoinLobbyPayload{RoomID: "r1"},
+		},
+		{
+			name:    "typing_update",
+			version: Current,
+			event:   models.WSEvent{Type: models.EventTypingUpdate, Payload: json.RawMessage(`{"wpm":80,"accuracy":97.5,"progress":40}`)},
+			want:    &models.TypingPayload{WPM: 80, Accuracy: 97.5, Progress: 40},
+		},
+		{
+			name:    "player_ready without a payload",
+			version: Current,
+			event:   models.WSEvent{Type: models.EventPlayerReady},
+			want:    &models.PlayerReadyPayload{},
+		},
+		{
+			name:    "leave_lobby with a payload",
+			version: Current,
+			event:   models.WSEvent{Type: models.EventLeaveLobby, Payload: json.RawMessage(`{"ignored":true}`)},
+			want:    &models.LeaveLobbyPayload{},
+		},
+		{name: "unknown event", version: Current, event: models.WSEvent{Type: "teleport", Payload: json.RawMessage(`{}`)}, code: models.CodeUnknownEvent},
+		{name: "server event", version: Current, event: models.WSEvent{Type: models.EventGameStart, Payload: json.RawMessage(`{}`)}, code: models.CodeUnknownEvent},
+		{name: "unsupported version", version: Current + 1, event: models.WSEvent{Type: models.EventJoinLobby, Payload: json.RawMessage(`{"room_id":"r1"}`)}, code: models.CodeUnknownEvent},
+		{name: "missing payload", version: Current, event: models.WSEvent{Type: models.EventChatMessage}, code: models.CodeInvalidPayload},
+		{name: "null payload", version: Current, event: models.WSEvent{Type: models.EventGameEnd, Payload: json.RawMessage(`null`)}, code: models.CodeInvalidPayload},
+		{name: "malformed payload", version: Current, event: models.WSEvent{Type: models.EventTypingUpdate, Payload: json.RawMessage(`{"wpm":"fast"}`)}, code: models.CodeInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.version, tt.event)
+			if tt.code != "" {
+				var refused *EventError
+				if !errors.As(err, &refused) || refused.Code != tt.code {
+					t.Fatalf("got %v, want a %s error", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%T %+v", got, got) != fmt.Sprintf("%T %+v", tt.want, tt.want) {
+				t.Fatalf("decoded %T %+v, want %T %+v", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecodersCoverClientEvents checks that every supported version can read
+// every event a client sends, so that one is not missed when a version is
+// added.
+func TestDecodersCoverClientEvents(t *testing.T) {
+	client := []models.EventType{
+		models.EventJoinLobby, models.EventLeaveLobby, models.EventPlayerReady,
+		models.EventTypingUpdate, models.EventChatMessage, models.EventGameEnd,
+	}
+	for version := MinSupported; version <= Current; version++ {
+		for _, eventType := range client {
+			if _, ok := decoders[version][eventType]; !ok {
+				t.Errorf("version %d has no decoder for %s", version, eventType)
+			}
+		}
+	}
+}
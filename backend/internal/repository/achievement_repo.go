@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AchievementRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAchievementRepository(db *pgxpool.Pool) *AchievementRepository {
+	return &AchievementRepository{db: db}
+}
+
+// GetUnlocked returns when each of a user's achievements was unlocked, keyed
+// by achievement ID
+func (r *AchievementRepository) GetUnlocked(ctx context.Context, userID string) (map[string]time.Time, error) {
+	query := `SELECT achievement_id, unlocked_at FROM user_achievements WHERE user_id = $1`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unlocked := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		unlocked[id] = at
+	}
+	return unlocked, rows.Err()
+}
+
+// Unlock records achievements for a user and returns the ones that were not
+// already unlocked, with their unlock time
+func (r *AchievementRepository) Unlock(ctx context.Context, userID, matchID string, ids []string) (map[string]time.Time, error) {
+	query := `
+		INSERT INTO user_achievements (user_id, achievement_id, match_id, unlocked_at)
+		SELECT $1, id, $2, $4 FROM unnest($3::text[]) AS id
+		ON CONFLICT (user_id, achievement_id) DO NOTHING
+		RETURNING achievement_id, unlocked_at
+	`
+	rows, err := r.db.Query(ctx, query, userID, matchID, ids, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unlocked := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		unlocked[id] = at
+	}
+	return unlocked, rows.Err()
+}
+
+// GetXP returns a user's XP and stored level. Users who never earned XP are
+// at zero and level 1.
+func (r *AchievementRepository) GetXP(ctx context.Context, userID string) (int64, int, error) {
+	var xp int64
+	level := 1
+	err := r.db.QueryRow(ctx, `SELECT xp, level FROM user_progress WHERE user_id = $1`, userID).Scan(&xp, &level)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 1, nil
+	}
+	return xp, level, err
+}
+
+// AddXP adds to a user's XP, sets the level that total reaches and returns
+// the new total
+func (r *AchievementRepository) AddXP(ctx context.Context, userID string, xp int64, levelFor func(int64) int) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var total int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO user_progress (user_id, xp, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET xp = user_progress.xp + EXCLUDED.xp, updated_at = EXCLUDED.updated_at
+		RETURNING xp
+	`, userID, xp, time.Now()).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE user_progress SET level = $2 WHERE user_id = $1`, userID, levelFor(total)); err != nil {
+		return 0, err
+	}
+	return total, tx.Commit(ctx)
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+const (
+	// Keys and bigrams seen fewer times than this have too noisy a rate to
+	// call them weak.
+	minKeyAttempts = 20
+
+	worstBigramsLimit = 10
+	trendKeysLimit    = 5
+)
+
+// keyWindow is the set of a user's matches analytics are computed over.
+// Nil bounds are open.
+const keyWindow = `
+	WITH m AS (
+		SELECT created_at,
+		       CASE WHEN jsonb_typeof(bad_keys) = 'object' THEN bad_keys ELSE '{}' END AS bad_keys,
+		       key_counts, bigram_counts, bad_bigrams
+		FROM matches
+		WHERE user_id = $1
+		  AND ($2::timestamptz IS NULL OR created_at >= $2)
+		  AND ($3::timestamptz IS NULL OR created_at < $3)
+	)
+`
+
+// GetKeyAnalytics merges bad_keys and the replayed key counts across a
+// user's matches between from and to, either of which may be nil.
+func (r *MatchRepository) GetKeyAnalytics(ctx context.Context, userID string, from, to *time.Time) (*models.KeyAnalytics, error) {
+	a := &models.KeyAnalytics{
+		UserID:       userID,
+		From:         from,
+		To:           to,
+		Keys:         []models.KeyStat{},
+		WorstBigrams: []models.KeyStat{},
+		Trend:        []models.KeyTrendPoint{},
+	}
+
+	err := r.db.QueryRow(ctx, keyWindow+`SELECT COUNT(*) FROM m`, userID, from, to).Scan(&a.Matches)
+	if err != nil || a.Matches == 0 {
+		return a, err
+	}
+
+	if err := r.keyStats(ctx, a); err != nil {
+		return nil, err
+	}
+	if err := r.worstBigrams(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// keyStats fills in the per-key totals and the weekly trend.
+func (r *MatchRepository) keyStats(ctx context.Context, a *models.KeyAnalytics) error {
+	query := keyWindow + `
+		, per_key AS (
+			SELECT date_trunc('week', m.created_at AT TIME ZONE 'UTC')::date AS week, e.key,
+			       CASE WHEN e.value ~ '^[0-9]+$' THEN e.value::int ELSE 0 END AS errors,
+			       m.key_counts IS NOT NULL AS tracked,
+			       0 AS attempts
+			FROM m, jsonb_each_text(m.bad_keys) e
+			UNION ALL
+			SELECT date_trunc('week', m.created_at AT TIME ZONE 'UTC')::date, c.key, 0, TRUE, c.value::int
+			FROM m, jsonb_each_text(m.key_counts) c
+			WHERE m.key_counts IS NOT NULL
+		)
+		SELECT week, key,
+		       SUM(errors),
+		       SUM(errors) FILTER (WHERE tracked),
+		       SUM(attempts)
+		FROM per_key
+		GROUP BY week, key
+		ORDER BY week
+	`
+	rows, err := r.db.Query(ctx, query, a.UserID, a.From, a.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var counts []keyCount
+	for rows.Next() {
+		var c keyCount
+		var trackedErrors *int
+		if err := rows.Scan(&c.week, &c.key, &c.errors, &trackedErrors, &c.attempts); err != nil {
+			return err
+		}
+		if trackedErrors != nil {
+			c.trackedErrors = *trackedErrors
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	summariseKeys(a, counts)
+	return nil
+}
+
+// keyCount is one key's errors and attempts over a week. trackedErrors only
+// counts errors from matches with key counts.
+type keyCount struct {
+	week          time.Time
+	key           string
+	errors        int
+	trackedErrors int
+	attempts      int
+}
+
+// summariseKeys fills in the per-key totals and the weekly trend from counts
+// ordered by week.
+func summariseKeys(a *models.KeyAnalytics, counts []keyCount) {
+	type totals struct{ errors, trackedErrors, attempts int }
+	keys := make(map[string]*totals)
+	weeks := make(map[string]map[string]*totals)
+	var weekOrder []string
+
+	for _, kc := range counts {
+		c := totals{errors: kc.errors, trackedErrors: kc.trackedErrors, attempts: kc.attempts}
+
+		total, ok := keys[kc.key]
+		if !ok {
+			total = &totals{}
+			keys[kc.key] = total
+		}
+		total.errors += c.errors
+		total.trackedErrors += c.trackedErrors
+		total.attempts += c.attempts
+
+		w := kc.week.Format(time.DateOnly)
+		if _, ok := weeks[w]; !ok {
+			weeks[w] = make(map[string]*totals)
+			weekOrder = append(weekOrder, w)
+		}
+		weeks[w][kc.key] = &c
+	}
+
+	for key, c := range keys {
+		a.Keys = append(a.Keys, models.KeyStat{
+			Key:       key,
+			Errors:    c.errors,
+			Attempts:  c.attempts,
+			ErrorRate: errorRate(c.trackedErrors, c.attempts),
+		})
+	}
+	sort.Slice(a.Keys, func(i, j int) bool { return worse(a.Keys[i], a.Keys[j]) })
+
+	// Follow the worst keys with enough data to mean something.
+	var trendKeys []string
+	for _, k := range a.Keys {
+		if len(trendKeys) < trendKeysLimit && k.Attempts >= minKeyAttempts {
+			trendKeys = append(trendKeys, k.Key)
+		}
+	}
+
+	for _, w := range weekOrder {
+		point := models.KeyTrendPoint{Week: w, Keys: make(map[string]float64)}
+		var trackedErrors int
+		for _, c := range weeks[w] {
+			point.Errors += c.errors
+			point.Attempts += c.attempts
+			trackedErrors += c.trackedErrors
+		}
+		point.ErrorRate = errorRate(trackedErrors, point.Attempts)
+		for _, key := range trendKeys {
+			if c, ok := weeks[w][key]; ok {
+				if rate := errorRate(c.trackedErrors, c.attempts); rate != nil {
+					point.Keys[key] = *rate
+				}
+			}
+		}
+		a.Trend = append(a.Trend, point)
+	}
+}
+
+func (r *MatchRepository) worstBigrams(ctx context.Context, a *models.KeyAnalytics) error {
+	query := keyWindow + `
+		SELECT b.key,
+		       SUM(COALESCE((m.bad_bigrams ->> b.key)::int, 0)) AS errors,
+		       SUM(b.value::int) AS attempts
+		FROM m, jsonb_each_text(m.bigram_counts) b
+		WHERE m.bigram_counts IS NOT NULL
+		GROUP BY b.key
+		HAVING SUM(b.value::int) >= $4
+		   AND SUM(COALESCE((m.bad_bigrams ->> b.key)::int, 0)) > 0
+		ORDER BY SUM(COALESCE((m.bad_bigrams ->> b.key)::int, 0))::float / SUM(b.value::int) DESC,
+		         errors DESC
+		LIMIT $5
+	`
+	rows, err := r.db.Query(ctx, query, a.UserID, a.From, a.To, minKeyAttempts, worstBigramsLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.KeyStat
+		if err := rows.Scan(&s.Key, &s.Errors, &s.Attempts); err != nil {
+			return err
+		}
+		s.ErrorRate = errorRate(s.Errors, s.Attempts)
+		a.WorstBigrams = append(a.WorstBigrams, s)
+	}
+	return rows.Err()
+}
+
+// worse orders keys by error rate, then by error count. Keys without enough
+// attempts for a reliable rate go after those with one.
+func worse(a, b models.KeyStat) bool {
+	ra, rb := a.ErrorRate != nil && a.Attempts >= minKeyAttempts, b.ErrorRate != nil && b.Attempts >= minKeyAttempts
+	if ra != rb {
+		return ra
+	}
+	if ra && *a.ErrorRate != *b.ErrorRate {
+		return *a.ErrorRate > *b.ErrorRate
+	}
+	if a.Errors != b.Errors {
+		return a.Errors > b.Errors
+	}
+	return a.Key < b.Key
+}
+
+func errorRate(errors, attempts int) *float64 {
+	if attempts == 0 {
+		return nil
+	}
+	rate := math.Round(float64(errors)/float64(attempts)*10000) / 10000
+	return &rate
+}
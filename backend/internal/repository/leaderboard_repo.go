@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// LeaderboardRepository stores the final standings of finished periods
+type LeaderboardRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLeaderboardRepository(db *pgxpool.Pool) *LeaderboardRepository {
+	return &LeaderboardRepository{db: db}
+}
+
+// ArchiveBoard saves the final standings of a board for a period. Archiving
+// the same period again leaves the saved standings untouched.
+func (r *LeaderboardRepository) ArchiveBoard(ctx context.Context, board models.Board, period models.Period, start time.Time, entries []models.LeaderboardEntry) error {
+	query := `
+		INSERT INTO leaderboard_archive (
+			period, period_start, mode, language, duration_seconds,
+			rank, user_id, username, wpm, match_id, achieved_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, '')::uuid, $11)
+		ON CONFLICT DO NOTHING
+	`
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		var achievedAt *time.Time
+		if !e.AchievedAt.IsZero() {
+			achievedAt = &e.AchievedAt
+		}
+		batch.Queue(query, string(period), start, board.Mode, board.Language, board.Duration,
+			e.Rank, e.UserID, e.Username, e.WPM, e.MatchID, achievedAt)
+	}
+	return r.db.SendBatch(ctx, batch).Close()
+}
+
+// GetArchive returns the archived standings of a board for the period
+// starting at start, or for its most recently archived period if start is
+// zero
+func (r *LeaderboardRepository) GetArchive(ctx context.Context, board models.Board, period models.Period, start time.Time, limit int) ([]*models.ArchivedEntry, error) {
+	query := `
+		SELECT period_start, rank, user_id, username, wpm,
+		       COALESCE(match_id::text, ''), COALESCE(achieved_at, archived_at)
+		FROM leaderboard_archive
+		WHERE period = $1 AND mode = $2 AND language = $3 AND duration_seconds = $4
+		  AND period_start = COALESCE($5, (
+		      SELECT MAX(period_start) FROM leaderboard_archive
+		      WHERE period = $1 AND mode = $2 AND language = $3 AND duration_seconds = $4
+		  ))
+		ORDER BY rank
+		LIMIT $6
+	`
+
+	var startParam *time.Time
+	if !start.IsZero() {
+		startParam = &start
+	}
+
+	rows, err := r.db.Query(ctx, query, string(period), board.Mode, board.Language, board.Duration, startParam, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ArchivedEntry
+	for rows.Next() {
+		e := &models.ArchivedEntry{Period: period, Board: board}
+		if err := rows.Scan(&e.PeriodStart, &e.Rank, &e.UserID, &e.Username, &e.WPM, &e.MatchID, &e.AchievedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
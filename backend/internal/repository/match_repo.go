@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
 )
@@ -20,21 +24,28 @@ func (r *MatchRepository) CreateMatch(ctx context.Context, match *models.MatchRe
 	query := `
 		INSERT INTO matches (
 			user_id, wpm, raw_wpm, accuracy, consistency, error_count,
-			mode, language, duration_seconds, bad_keys, improvement_needed
+			mode, language, duration_seconds, bad_keys, improvement_needed,
+			verification, flag_reasons, key_counts, bigram_counts, bad_bigrams
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+			NULLIF($14, '')::jsonb, NULLIF($15, '')::jsonb, NULLIF($16, '')::jsonb)
 		RETURNING id, created_at
 	`
 
 	if match.BadKeys == "" {
 		match.BadKeys = "{}"
 	}
+	if match.Verification == "" {
+		match.Verification = "unverified"
+	}
 
 	var createdAt time.Time
 	err := r.db.QueryRow(ctx, query,
 		match.UserID, match.WPM, match.RawWPM, match.Accuracy,
 		match.Consistency, match.ErrorCount, match.Mode, match.Language,
 		match.Duration, match.BadKeys, match.ImprovementNeeded,
+		match.Verification, match.FlagReasons,
+		match.KeyCounts, match.BigramCounts, match.BadBigrams,
 	).Scan(&match.ID, &createdAt)
 
 	if err == nil {
@@ -44,17 +55,90 @@ func (r *MatchRepository) CreateMatch(ctx context.Context, match *models.MatchRe
 	return err
 }
 
+const matchColumns = `
+	id, user_id, wpm, raw_wpm, accuracy, consistency, error_count,
+	mode, language, duration_seconds, created_at, bad_keys, improvement_needed,
+	verification, COALESCE(flag_reasons, '')
+`
+
 func (r *MatchRepository) GetMatchesByUserID(ctx context.Context, userID string, limit int) ([]*models.MatchResult, error) {
-	query := `
-		SELECT id, user_id, wpm, raw_wpm, accuracy, consistency, error_count,
-		       mode, language, duration_seconds, created_at, bad_keys, improvement_needed
-		FROM matches
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2
-	`
+	return r.ListMatches(ctx, models.MatchFilter{UserID: userID, Sort: models.SortNewest, Limit: limit})
+}
+
+// ListMatches returns a page of a user's matches. Pages are keyed on the
+// sort columns plus id, so they stay stable while new matches are added; the
+// next page starts after the last match returned. A cursor that is not one
+// of the user's matches gives ErrInvalidCursor.
+func (r *MatchRepository) ListMatches(ctx context.Context, f models.MatchFilter) ([]*models.MatchResult, error) {
+	if f.Cursor != "" {
+		var found bool
+		err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM matches WHERE id = $1 AND user_id = $2)`, f.Cursor, f.UserID).Scan(&found)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "22P02" {
+			// Not a UUID
+			return nil, ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	where := []string{"user_id = $1"}
+	args := []any{f.UserID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
-	rows, err := r.db.Query(ctx, query, userID, limit)
+	if f.Mode != "" {
+		where = append(where, "mode = "+arg(f.Mode))
+	}
+	if f.Language != "" {
+		where = append(where, "language = "+arg(f.Language))
+	}
+	if f.MinDuration > 0 {
+		where = append(where, "duration_seconds >= "+arg(f.MinDuration))
+	}
+	if f.MaxDuration > 0 {
+		where = append(where, "duration_seconds <= "+arg(f.MaxDuration))
+	}
+	if f.MinWPM > 0 {
+		where = append(where, "wpm >= "+arg(f.MinWPM))
+	}
+	if f.MaxWPM > 0 {
+		where = append(where, "wpm <= "+arg(f.MaxWPM))
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < "+arg(f.To))
+	}
+
+	var keys, order string
+	switch f.Sort {
+	case models.SortOldest:
+		keys, order = "created_at, id", "created_at ASC, id ASC"
+	case models.SortFastest:
+		keys, order = "wpm, created_at, id", "wpm DESC, created_at DESC, id DESC"
+	default:
+		keys, order = "created_at, id", "created_at DESC, id DESC"
+	}
+	if f.Cursor != "" {
+		cmp := "<"
+		if f.Sort == models.SortOldest {
+			cmp = ">"
+		}
+		where = append(where, fmt.Sprintf("(%s) %s (SELECT %s FROM matches WHERE id = %s)", keys, cmp, keys, arg(f.Cursor)))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM matches WHERE %s ORDER BY %s LIMIT %s",
+		matchColumns, strings.Join(where, " AND "), order, arg(f.Limit))
+
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +154,7 @@ func (r *MatchRepository) GetMatchesByUserID(ctx context.Context, userID string,
 			&m.ID, &m.UserID, &m.WPM, &m.RawWPM, &m.Accuracy,
 			&m.Consistency, &m.ErrorCount, &m.Mode, &m.Language,
 			&m.Duration, &createdAt, &badKeys, &improvementNeeded,
+			&m.Verification, &m.FlagReasons,
 		); err != nil {
 			return nil, err
 		}
@@ -78,5 +163,36 @@ func (r *MatchRepository) GetMatchesByUserID(ctx context.Context, userID string,
 		m.ImprovementNeeded = string(improvementNeeded)
 		matches = append(matches, &m)
 	}
-	return matches, nil
+	return matches, rows.Err()
+}
+
+// ForEachRankedMatch calls fn with every verified match played at or after
+// since, oldest first. Only the fields that decide leaderboard placing are
+// filled in.
+func (r *MatchRepository) ForEachRankedMatch(ctx context.Context, since time.Time, fn func(m *models.MatchResult, playedAt time.Time) error) error {
+	query := `
+		SELECT id, user_id, wpm, mode, COALESCE(language, ''), duration_seconds, created_at
+		FROM matches
+		WHERE verification = 'verified' AND created_at >= $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.MatchResult
+		var playedAt time.Time
+		if err := rows.Scan(&m.ID, &m.UserID, &m.WPM, &m.Mode, &m.Language, &m.Duration, &playedAt); err != nil {
+			return err
+		}
+		m.CreatedAt = playedAt.Format(time.RFC3339)
+		if err := fn(&m, playedAt); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryAchievementStore is an AchievementStore held in memory
+type MemoryAchievementStore struct {
+	mu       sync.Mutex
+	unlocked map[string]map[string]time.Time // User ID, then achievement ID
+	xp       map[string]int64
+	levels   map[string]int
+}
+
+func NewMemoryAchievementStore() *MemoryAchievementStore {
+	return &MemoryAchievementStore{
+		unlocked: make(map[string]map[string]time.Time),
+		xp:       make(map[string]int64),
+		levels:   make(map[string]int),
+	}
+}
+
+func (s *MemoryAchievementStore) GetUnlocked(ctx context.Context, userID string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlocked := make(map[string]time.Time, len(s.unlocked[userID]))
+	for id, at := range s.unlocked[userID] {
+		unlocked[id] = at
+	}
+	return unlocked, nil
+}
+
+func (s *MemoryAchievementStore) Unlock(ctx context.Context, userID, matchID string, ids []string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	have, ok := s.unlocked[userID]
+	if !ok {
+		have = make(map[string]time.Time)
+		s.unlocked[userID] = have
+	}
+
+	now := time.Now()
+	unlocked := make(map[string]time.Time)
+	for _, id := range ids {
+		if _, ok := have[id]; ok {
+			continue
+		}
+		have[id] = now
+		unlocked[id] = now
+	}
+	return unlocked, nil
+}
+
+func (s *MemoryAchievementStore) GetXP(ctx context.Context, userID string) (int64, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	level, ok := s.levels[userID]
+	if !ok {
+		return 0, 1, nil
+	}
+	return s.xp[userID], level, nil
+}
+
+func (s *MemoryAchievementStore) AddXP(ctx context.Context, userID string, xp int64, levelFor func(int64) int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.xp[userID] += xp
+	s.levels[userID] = levelFor(s.xp[userID])
+	return s.xp[userID], nil
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// MemoryCache is a ResultCache, SessionStore, RaceStore and PassageStore
+// held in memory
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value    string
+	expireAt time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheEntry)}
+}
+
+func (c *MemoryCache) set(key, value string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{value: value, expireAt: time.Now().Add(ttl)}
+}
+
+func (c *MemoryCache) get(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	if !time.Now().Before(e.expireAt) {
+		delete(c.entries, key)
+		return "", ErrCacheMiss
+	}
+	return e.value, nil
+}
+
+// take gets an entry and removes it in one step
+func (c *MemoryCache) take(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	delete(c.entries, key)
+	if !time.Now().Before(e.expireAt) {
+		return "", ErrCacheMiss
+	}
+	return e.value, nil
+}
+
+func (c *MemoryCache) del(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+func (c *MemoryCache) CacheMatchHistory(ctx context.Context, userID string, historyJSON []byte) error {
+	c.set("history:"+userID, string(historyJSON), 5*time.Minute)
+	return nil
+}
+
+func (c *MemoryCache) GetCachedMatchHistory(ctx context.Context, userID string) (string, error) {
+	return c.get("history:" + userID)
+}
+
+func (c *MemoryCache) CacheUserStats(ctx context.Context, userID string, statsJSON []byte) error {
+	c.set("stats:"+userID, string(statsJSON), 5*time.Minute)
+	return nil
+}
+
+func (c *MemoryCache) GetCachedUserStats(ctx context.Context, userID string) (string, error) {
+	return c.get("stats:" + userID)
+}
+
+func (c *MemoryCache) InvalidateMatchCaches(ctx context.Context, userID string) error {
+	c.del("history:"+userID, "stats:"+userID)
+	return nil
+}
+
+func (c *MemoryCache) CreateSession(ctx context.Context, sessionID string, userID string, ttl time.Duration) error {
+	c.set("session:"+sessionID, userID, ttl)
+	return nil
+}
+
+func (c *MemoryCache) GetSession(ctx context.Context, sessionID string) (string, error) {
+	return c.get("session:" + sessionID)
+}
+
+func (c *MemoryCache) DeleteSession(ctx context.Context, sessionID string) error {
+	c.del("session:" + sessionID)
+	return nil
+}
+
+func (c *MemoryCache) SaveRace(ctx context.Context, race *models.RaceSnapshot, ttl time.Duration) error {
+	data, err := json.Marshal(race)
+	if err != nil {
+		return err
+	}
+	c.set("race:"+race.RoomID, string(data), ttl)
+	return nil
+}
+
+func (c *MemoryCache) GetRace(ctx context.Context, roomID string) (*models.RaceSnapshot, error) {
+	val, err := c.get("race:" + roomID)
+	if err == ErrCacheMiss {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var race models.RaceSnapshot
+	if err := json.Unmarshal([]byte(val), &race); err != nil {
+		return nil, err
+	}
+	return &race, nil
+}
+
+func (c *MemoryCache) DeleteRace(ctx context.Context, roomID string) error {
+	c.del("race:" + roomID)
+	return nil
+}
+
+func (c *MemoryCache) IssuePassage(ctx context.Context, userID string, test models.IssuedTest, ttl time.Duration) error {
+	data, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	c.set("passage:"+userID, string(data), ttl)
+	return nil
+}
+
+func (c *MemoryCache) TakePassage(ctx context.Context, userID string) (*models.IssuedTest, error) {
+	val, err := c.take("passage:" + userID)
+	if err != nil {
+		return nil, err
+	}
+	var test models.IssuedTest
+	if err := json.Unmarshal([]byte(val), &test); err != nil {
+		return nil, err
+	}
+	return &test, nil
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// MemoryLeaderboardStore is a LeaderboardStore held in memory. Boards are
+// keyed and expire the same way as in Redis.
+type MemoryLeaderboardStore struct {
+	mu      sync.Mutex
+	boards  map[string]*memoryBoard
+	indexes map[string]map[models.Board]time.Time // Period index, then when each board leaves it
+	claims  map[string]time.Time
+}
+
+type memoryBoard struct {
+	expireAt time.Time // Zero for boards kept forever
+	scores   map[string]models.LeaderboardEntry
+}
+
+func NewMemoryLeaderboardStore() *MemoryLeaderboardStore {
+	return &MemoryLeaderboardStore{
+		boards:  make(map[string]*memoryBoard),
+		indexes: make(map[string]map[models.Board]time.Time),
+		claims:  make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryLeaderboardStore) UpdateLeaderboard(ctx context.Context, board models.Board, userID string, wpm int, matchID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, period := range models.Periods {
+		start := period.Start(at)
+		expireAt := periodExpiry(period, start)
+		if !expireAt.IsZero() && !expireAt.After(now) {
+			continue
+		}
+
+		b := s.board(leaderboardKey(board, period, start), now)
+		if b == nil {
+			b = &memoryBoard{scores: make(map[string]models.LeaderboardEntry)}
+			s.boards[leaderboardKey(board, period, start)] = b
+		}
+		b.expireAt = expireAt
+		if cur, ok := b.scores[userID]; !ok || wpm > cur.WPM {
+			b.scores[userID] = models.LeaderboardEntry{UserID: userID, WPM: wpm, MatchID: matchID, AchievedAt: at.UTC().Truncate(time.Millisecond)}
+		}
+
+		if period != models.AllTime {
+			s.index(period, start, board, expireAt)
+		}
+	}
+	return nil
+}
+
+// board returns a live board, dropping it if it has expired
+func (s *MemoryLeaderboardStore) board(key string, now time.Time) *memoryBoard {
+	b, ok := s.boards[key]
+	if !ok {
+		return nil
+	}
+	if !b.expireAt.IsZero() && !b.expireAt.After(now) {
+		delete(s.boards, key)
+		return nil
+	}
+	return b
+}
+
+func (s *MemoryLeaderboardStore) index(period models.Period, start time.Time, board models.Board, expireAt time.Time) {
+	key := periodIndexKey(period, start)
+	idx, ok := s.indexes[key]
+	if !ok {
+		idx = make(map[models.Board]time.Time)
+		s.indexes[key] = idx
+	}
+	idx[board] = expireAt
+}
+
+// ranked returns a board's entries highest score first. Ties are ordered by
+// member, highest first, as ZREVRANGE orders them.
+func (b *memoryBoard) ranked() []models.LeaderboardEntry {
+	entries := make([]models.LeaderboardEntry, 0, len(b.scores))
+	for _, e := range b.scores {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].WPM != entries[j].WPM {
+			return entries[i].WPM > entries[j].WPM
+		}
+		return entries[i].UserID > entries[j].UserID
+	})
+	for i := range entries {
+		entries[i].Rank = int64(i) + 1
+	}
+	return entries
+}
+
+func (s *MemoryLeaderboardStore) GetTopPlayers(ctx context.Context, board models.Board, period models.Period, start time.Time, offset, limit int64) ([]models.LeaderboardEntry, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.board(leaderboardKey(board, period, start), time.Now())
+	if b == nil {
+		return []models.LeaderboardEntry{}, 0, nil
+	}
+	entries := b.ranked()
+	total := int64(len(entries))
+	if offset >= total {
+		return []models.LeaderboardEntry{}, total, nil
+	}
+	return entries[offset:min(offset+limit, total)], total, nil
+}
+
+func (s *MemoryLeaderboardStore) GetPlayerRank(ctx context.Context, board models.Board, period models.Period, start time.Time, userID string) (*models.LeaderboardEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.board(leaderboardKey(board, period, start), time.Now())
+	if b == nil {
+		return nil, nil
+	}
+	for _, e := range b.ranked() {
+		if e.UserID == userID {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryLeaderboardStore) GetPeriodBoards(ctx context.Context, period models.Period, start time.Time) ([]models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	boards := []models.Board{}
+	for board, expireAt := range s.indexes[periodIndexKey(period, start)] {
+		if expireAt.After(now) {
+			boards = append(boards, board)
+		}
+	}
+	return boards, nil
+}
+
+func (s *MemoryLeaderboardStore) ClaimArchive(ctx context.Context, period models.Period, start time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := string(period) + ":" + start.Format(time.DateOnly)
+	if expireAt, ok := s.claims[key]; ok && expireAt.After(time.Now()) {
+		return false, nil
+	}
+	s.claims[key] = period.Next(start).Add(2 * LeaderboardGrace)
+	return true, nil
+}
+
+func (s *MemoryLeaderboardStore) ReleaseArchive(ctx context.Context, period models.Period, start time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claims, string(period)+":"+start.Format(time.DateOnly))
+	return nil
+}
+
+// ApplyLeaderboardRebuild replaces every board with the rebuilt one and
+// drops boards that no longer have any scores
+func (s *MemoryLeaderboardStore) ApplyLeaderboardRebuild(ctx context.Context, b *LeaderboardRebuild) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.boards = make(map[string]*memoryBoard, len(b.boards))
+	for key, rb := range b.boards {
+		board := &memoryBoard{expireAt: rb.expireAt, scores: make(map[string]models.LeaderboardEntry, len(rb.best))}
+		for userID, e := range rb.best {
+			e.AchievedAt = e.AchievedAt.UTC().Truncate(time.Millisecond)
+			board.scores[userID] = e
+		}
+		s.boards[key] = board
+
+		if rb.index != "" {
+			idx, ok := s.indexes[rb.index]
+			if !ok {
+				idx = make(map[models.Board]time.Time)
+				s.indexes[rb.index] = idx
+			}
+			idx[rb.board] = rb.expireAt
+		}
+	}
+	return len(b.boards), nil
+}
+
+// MemoryLeaderboardArchive is a LeaderboardArchive held in memory
+type MemoryLeaderboardArchive struct {
+	mu      sync.RWMutex
+	periods map[archiveKey]map[int64]*models.ArchivedEntry // Keyed by rank
+}
+
+type archiveKey struct {
+	board  models.Board
+	period models.Period
+	start  string // YYYY-MM-DD
+}
+
+func NewMemoryLeaderboardArchive() *MemoryLeaderboardArchive {
+	return &MemoryLeaderboardArchive{periods: make(map[archiveKey]map[int64]*models.ArchivedEntry)}
+}
+
+func (a *MemoryLeaderboardArchive) ArchiveBoard(ctx context.Context, board models.Board, period models.Period, start time.Time, entries []models.LeaderboardEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	k := archiveKey{board: board, period: period, start: start.Format(time.DateOnly)}
+	ranks, ok := a.periods[k]
+	if !ok {
+		ranks = make(map[int64]*models.ArchivedEntry)
+		a.periods[k] = ranks
+	}
+
+	now := time.Now()
+	periodStart, _ := time.Parse(time.DateOnly, k.start)
+	for _, e := range entries {
+		if _, ok := ranks[e.Rank]; ok {
+			continue
+		}
+		if e.AchievedAt.IsZero() {
+			e.AchievedAt = now
+		}
+		ranks[e.Rank] = &models.ArchivedEntry{LeaderboardEntry: e, Period: period, PeriodStart: periodStart, Board: board}
+	}
+	return nil
+}
+
+func (a *MemoryLeaderboardArchive) GetArchive(ctx context.Context, board models.Board, period models.Period, start time.Time, limit int) ([]*models.ArchivedEntry, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	k := archiveKey{board: board, period: period}
+	if start.IsZero() {
+		for other := range a.periods {
+			if other.board == board && other.period == period && other.start > k.start {
+				k.start = other.start
+			}
+		}
+	} else {
+		k.start = start.Format(time.DateOnly)
+	}
+
+	var entries []*models.ArchivedEntry
+	for _, e := range a.periods[k] {
+		entry := *e
+		entries = append(entries, &entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rank < entries[j].Rank })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// MemoryMatchStore is a MatchStore held in memory
+type MemoryMatchStore struct {
+	mu      sync.RWMutex
+	matches []storedMatch // In insertion order
+}
+
+type storedMatch struct {
+	models.MatchResult
+	createdAt time.Time
+}
+
+func NewMemoryMatchStore() *MemoryMatchStore {
+	return &MemoryMatchStore{}
+}
+
+func (s *MemoryMatchStore) CreateMatch(ctx context.Context, match *models.MatchResult) error {
+	if match.BadKeys == "" {
+		match.BadKeys = "{}"
+	}
+	if match.Verification == "" {
+		match.Verification = "unverified"
+	}
+	if match.Language == "" {
+		match.Language = models.DefaultLanguage
+	}
+
+	now := time.Now()
+	match.ID = newID()
+	match.CreatedAt = now.Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.matches = append(s.matches, storedMatch{MatchResult: *match, createdAt: now})
+	return nil
+}
+
+// ListMatches pages through a user's matches the same way as the
+// PostgreSQL store, with the cursor naming the last match of the page before
+func (s *MemoryMatchStore) ListMatches(ctx context.Context, f models.MatchFilter) ([]*models.MatchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []storedMatch
+	var cursor *storedMatch
+	for i, m := range s.matches {
+		if m.ID == f.Cursor && m.UserID == f.UserID {
+			cursor = &s.matches[i]
+		}
+		if m.UserID != f.UserID ||
+			(f.Mode != "" && m.Mode != f.Mode) ||
+			(f.Language != "" && m.Language != f.Language) ||
+			(f.MinDuration > 0 && m.Duration < f.MinDuration) ||
+			(f.MaxDuration > 0 && m.Duration > f.MaxDuration) ||
+			(f.MinWPM > 0 && m.WPM < f.MinWPM) ||
+			(f.MaxWPM > 0 && m.WPM > f.MaxWPM) ||
+			(!f.From.IsZero() && m.createdAt.Before(f.From)) ||
+			(!f.To.IsZero() && !m.createdAt.Before(f.To)) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	if f.Cursor != "" && cursor == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// before reports whether a comes before b in the requested order
+	before := func(a, b *storedMatch) bool {
+		switch f.Sort {
+		case models.SortOldest:
+			if !a.createdAt.Equal(b.createdAt) {
+				return a.createdAt.Before(b.createdAt)
+			}
+			return a.ID < b.ID
+		case models.SortFastest:
+			if a.WPM != b.WPM {
+				return a.WPM > b.WPM
+			}
+		}
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.After(b.createdAt)
+		}
+		return a.ID > b.ID
+	}
+	sort.Slice(matches, func(i, j int) bool { return before(&matches[i], &matches[j]) })
+
+	page := []*models.MatchResult{}
+	for i := range matches {
+		if len(page) == f.Limit {
+			break
+		}
+		if cursor != nil && !before(cursor, &matches[i]) {
+			continue
+		}
+		m := matches[i].MatchResult
+		page = append(page, &m)
+	}
+	if len(page) == 0 {
+		return nil, nil
+	}
+	return page, nil
+}
+
+func (s *MemoryMatchStore) ForEachRankedMatch(ctx context.Context, since time.Time, fn func(m *models.MatchResult, playedAt time.Time) error) error {
+	s.mu.RLock()
+	var ranked []storedMatch
+	for _, m := range s.matches {
+		if m.Verification == "verified" && !m.createdAt.Before(since) {
+			ranked = append(ranked, m)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].createdAt.Before(ranked[j].createdAt) })
+	for _, m := range ranked {
+		match := m.MatchResult
+		if err := fn(&match, m.createdAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userMatches returns a user's matches, oldest first, that fall between from
+// and to when they are set
+func (s *MemoryMatchStore) userMatches(userID string, from, to *time.Time) []storedMatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []storedMatch
+	for _, m := range s.matches {
+		if m.UserID != userID ||
+			(from != nil && m.createdAt.Before(*from)) ||
+			(to != nil && !m.createdAt.Before(*to)) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].createdAt.Before(matches[j].createdAt) })
+	return matches
+}
+
+func (s *MemoryMatchStore) GetUserStats(ctx context.Context, userID string, trendDays int, verifiedOnly bool) (*models.UserStats, error) {
+	stats := &models.UserStats{
+		UserID:        userID,
+		PersonalBests: []models.PersonalBest{},
+		Trend:         []models.TrendPoint{},
+	}
+
+	matches := s.userMatches(userID, nil, nil)
+	if verifiedOnly {
+		matches = slices.DeleteFunc(matches, func(m storedMatch) bool { return m.Verification != "verified" })
+	}
+	if len(matches) == 0 {
+		return stats, nil
+	}
+
+	var wpm, accuracy float64
+	for _, m := range matches {
+		wpm += float64(m.WPM)
+		accuracy += m.Accuracy
+		if m.Verification == "verified" {
+			stats.MaxWPM = max(stats.MaxWPM, m.WPM)
+		}
+		stats.TotalTimeSeconds += m.Duration
+	}
+	stats.TotalMatches = len(matches)
+	stats.AvgWPM = round1(wpm / float64(len(matches)))
+	stats.AvgAccuracy = round1(accuracy / float64(len(matches)))
+	first, last := matches[0].createdAt, matches[len(matches)-1].createdAt
+	stats.FirstMatchAt, stats.LastMatchAt = &first, &last
+
+	// Personal bests, fastest then earliest in each mode and length
+	type modeKey struct {
+		mode     string
+		duration int
+	}
+	bests := make(map[modeKey]storedMatch)
+	for _, m := range matches {
+		if m.Verification != "verified" {
+			continue
+		}
+		k := modeKey{m.Mode, m.Duration}
+		if cur, ok := bests[k]; !ok || m.WPM > cur.WPM {
+			bests[k] = m
+		}
+	}
+	for _, m := range bests {
+		stats.PersonalBests = append(stats.PersonalBests, models.PersonalBest{
+			Mode:       m.Mode,
+			Duration:   m.Duration,
+			WPM:        m.WPM,
+			Accuracy:   m.Accuracy,
+			MatchID:    m.ID,
+			AchievedAt: m.createdAt,
+		})
+	}
+	sort.Slice(stats.PersonalBests, func(i, j int) bool {
+		a, b := stats.PersonalBests[i], stats.PersonalBests[j]
+		if a.Mode != b.Mode {
+			return a.Mode < b.Mode
+		}
+		return a.Duration < b.Duration
+	})
+
+	// Daily trend
+	since := time.Now().UTC().AddDate(0, 0, -trendDays)
+	for _, m := range matches {
+		if m.createdAt.Before(since) {
+			continue
+		}
+		day := m.createdAt.UTC().Format(time.DateOnly)
+		if n := len(stats.Trend); n == 0 || stats.Trend[n-1].Date != day {
+			stats.Trend = append(stats.Trend, models.TrendPoint{Date: day})
+		}
+		p := &stats.Trend[len(stats.Trend)-1]
+		p.Matches++
+		p.AvgWPM += float64(m.WPM)
+		p.AvgAccuracy += m.Accuracy
+	}
+	for i := range stats.Trend {
+		p := &stats.Trend[i]
+		p.AvgWPM = round1(p.AvgWPM / float64(p.Matches))
+		p.AvgAccuracy = round1(p.AvgAccuracy / float64(p.Matches))
+	}
+
+	// Streaks of consecutive UTC days
+	var lastDay time.Time
+	run := 0
+	for _, m := range matches {
+		t := m.createdAt.UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		switch {
+		case day.Equal(lastDay):
+			continue
+		case day.Equal(lastDay.AddDate(0, 0, 1)):
+			run++
+		default:
+			run = 1
+		}
+		lastDay = day
+		stats.Streak.Longest = max(stats.Streak.Longest, run)
+	}
+	stats.Streak.LastActive = lastDay.Format(time.DateOnly)
+	if stats.Streak.LastActive >= time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly) {
+		stats.Streak.Current = run
+	}
+	return stats, nil
+}
+
+func (s *MemoryMatchStore) GetKeyAnalytics(ctx context.Context, userID string, from, to *time.Time) (*models.KeyAnalytics, error) {
+	a := &models.KeyAnalytics{
+		UserID:       userID,
+		From:         from,
+		To:           to,
+		Keys:         []models.KeyStat{},
+		WorstBigrams: []models.KeyStat{},
+		Trend:        []models.KeyTrendPoint{},
+	}
+
+	matches := s.userMatches(userID, from, to)
+	a.Matches = len(matches)
+	if a.Matches == 0 {
+		return a, nil
+	}
+
+	type weekKey struct {
+		week time.Time
+		key  string
+	}
+	perKey := make(map[weekKey]*keyCount)
+	count := func(week time.Time, key string) *keyCount {
+		k := weekKey{week, key}
+		c, ok := perKey[k]
+		if !ok {
+			c = &keyCount{week: week, key: key}
+			perKey[k] = c
+		}
+		return c
+	}
+
+	type bigramCount struct{ errors, attempts int }
+	bigrams := make(map[string]*bigramCount)
+
+	for _, m := range matches {
+		week := models.Weekly.Start(m.createdAt)
+		tracked := m.KeyCounts != ""
+
+		for key, errors := range badKeyCounts(m.BadKeys) {
+			c := count(week, key)
+			c.errors += errors
+			if tracked {
+				c.trackedErrors += errors
+			}
+		}
+		for key, attempts := range intCounts(m.KeyCounts) {
+			count(week, key).attempts += attempts
+		}
+
+		if m.BigramCounts == "" {
+			continue
+		}
+		bad := intCounts(m.BadBigrams)
+		for key, attempts := range intCounts(m.BigramCounts) {
+			b, ok := bigrams[key]
+			if !ok {
+				b = &bigramCount{}
+				bigrams[key] = b
+			}
+			b.attempts += attempts
+			b.errors += bad[key]
+		}
+	}
+
+	counts := make([]keyCount, 0, len(perKey))
+	for _, c := range perKey {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].week.Before(counts[j].week) })
+	summariseKeys(a, counts)
+
+	for key, b := range bigrams {
+		if b.attempts >= minKeyAttempts && b.errors > 0 {
+			a.WorstBigrams = append(a.WorstBigrams, models.KeyStat{
+				Key:       key,
+				Errors:    b.errors,
+				Attempts:  b.attempts,
+				ErrorRate: errorRate(b.errors, b.attempts),
+			})
+		}
+	}
+	sort.Slice(a.WorstBigrams, func(i, j int) bool {
+		x, y := a.WorstBigrams[i], a.WorstBigrams[j]
+		rx, ry := float64(x.Errors)/float64(x.Attempts), float64(y.Errors)/float64(y.Attempts)
+		if rx != ry {
+			return rx > ry
+		}
+		if x.Errors != y.Errors {
+			return x.Errors > y.Errors
+		}
+		return x.Key < y.Key
+	})
+	if len(a.WorstBigrams) > worstBigramsLimit {
+		a.WorstBigrams = a.WorstBigrams[:worstBigramsLimit]
+	}
+	return a, nil
+}
+
+// badKeyCounts reads a bad_keys object, counting values that are not whole
+// numbers as zero
+func badKeyCounts(badKeys string) map[string]int {
+	var raw map[string]any
+	if json.Unmarshal([]byte(badKeys), &raw) != nil {
+		return nil
+	}
+	counts := make(map[string]int, len(raw))
+	for key, v := range raw {
+		switch v := v.(type) {
+		case float64:
+			if v >= 0 && v == math.Trunc(v) {
+				counts[key] = int(v)
+			} else {
+				counts[key] = 0
+			}
+		case string:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				n = 0
+			}
+			counts[key] = n
+		default:
+			counts[key] = 0
+		}
+	}
+	return counts
+}
+
+func intCounts(data string) map[string]int {
+	var counts map[string]int
+	if data != "" {
+		json.Unmarshal([]byte(data), &counts)
+	}
+	return counts
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// newID returns a random version 4 UUID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
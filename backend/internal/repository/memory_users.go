@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// MemoryUserStore is a UserStore held in memory
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*storedUser
+}
+
+type storedUser struct {
+	models.User
+	passwordHash string
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[string]*storedUser)}
+}
+
+func (s *MemoryUserStore) GetUser(ctx context.Context, id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return u.Username, nil
+}
+
+func (s *MemoryUserStore) GetUsernames(ctx context.Context, ids []string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make(map[string]string, len(ids))
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			names[id] = u.Username
+		}
+	}
+	return names, nil
+}
+
+func (s *MemoryUserStore) CreateGuestAccount(ctx context.Context, username string) (*models.User, error) {
+	return s.insert(&storedUser{User: models.User{Username: username, IsGuest: true}})
+}
+
+func (s *MemoryUserStore) CreateUser(ctx context.Context, username, email, passwordHash string) (*models.User, error) {
+	return s.insert(&storedUser{User: models.User{Username: username, Email: email}, passwordHash: passwordHash})
+}
+
+func (s *MemoryUserStore) insert(u *storedUser) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUnique("", u.Username, u.Email); err != nil {
+		return nil, err
+	}
+	u.ID = newID()
+	u.CreatedAt = time.Now()
+	s.users[u.ID] = u
+
+	user := u.User
+	return &user, nil
+}
+
+func (s *MemoryUserStore) UpgradeGuest(ctx context.Context, id, username, email, passwordHash string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || !u.IsGuest {
+		return nil, ErrUserNotFound
+	}
+	if err := s.checkUnique(id, username, email); err != nil {
+		return nil, err
+	}
+	u.Username, u.Email, u.passwordHash, u.IsGuest = username, email, passwordHash, false
+
+	user := u.User
+	return &user, nil
+}
+
+// checkUnique mirrors the unique constraints on username and email, ignoring
+// the user being updated
+func (s *MemoryUserStore) checkUnique(id, username, email string) error {
+	for _, other := range s.users {
+		if other.ID == id {
+			continue
+		}
+		if other.Username == username {
+			return ErrUsernameTaken
+		}
+		if email != "" && other.Email == email {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user := u.User
+	return &user, nil
+}
+
+func (s *MemoryUserStore) GetCredentials(ctx context.Context, email string) (*models.User, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if !u.IsGuest && u.Email == email {
+			user := u.User
+			return &user, u.passwordHash, nil
+		}
+	}
+	return nil, "", ErrUserNotFound
+}
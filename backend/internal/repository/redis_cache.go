@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -18,25 +22,296 @@ func NewRedisCache(client *redis.Client) *RedisCache {
 	}
 }
 
-// UpdateLeaderboard adds a user's score to the leaderboard
-func (c *RedisCache) UpdateLeaderboard(ctx context.Context, userID string, username string, wpm int) error {
-	// Member format: "username:userID" to avoid extra lookups
-	member := fmt.Sprintf("%s:%s", username, userID)
+// LeaderboardGrace is how long a period's boards are kept after it ends, so
+// that they can still be archived after downtime.
+const LeaderboardGrace = 7 * 24 * time.Hour
 
-	// ZADD updates the score if member exists, or adds new member
-	err := c.client.ZAdd(ctx, "leaderboard:global", redis.Z{
-		Score:  float64(wpm),
-		Member: member,
-	}).Err()
+func leaderboardKey(board models.Board, period models.Period, start time.Time) string {
+	if period == models.AllTime {
+		return fmt.Sprintf("leaderboard:%s:%s:%d", board.Mode, board.Language, board.Duration)
+	}
+	return fmt.Sprintf("leaderboard:%s:%s:%s:%s:%d", period, start.Format(time.DateOnly), board.Mode, board.Language, board.Duration)
+}
+
+// leaderboardMatchKey names the hash that records, for each user on a board,
+// the match that set their score and when.
+func leaderboardMatchKey(key string) string {
+	return "leaderboard_match:" + strings.TrimPrefix(key, "leaderboard:")
+}
+
+// periodIndexKey names the set of boards that have scores in a period
+func periodIndexKey(period models.Period, start time.Time) string {
+	return fmt.Sprintf("leaderboards:%s:%s", period, start.Format(time.DateOnly))
+}
+
+// periodExpiry returns when a period's boards are dropped, or the zero time
+// for boards that are kept forever.
+func periodExpiry(period models.Period, start time.Time) time.Time {
+	if period == models.AllTime {
+		return time.Time{}
+	}
+	return period.Next(start).Add(LeaderboardGrace)
+}
+
+// personalBest only raises a user's score, and records the match whenever it
+// does. KEYS: board, match hash. ARGV: score, user ID, match record, expiry
+// as unix seconds or 0.
+var personalBest = redis.NewScript(`
+local changed = redis.call('ZADD', KEYS[1], 'GT', 'CH', ARGV[1], ARGV[2])
+if changed == 1 then
+	redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+end
+if ARGV[4] ~= '0' then
+	redis.call('EXPIREAT', KEYS[1], ARGV[4])
+	redis.call('EXPIREAT', KEYS[2], ARGV[4])
+end
+return changed
+`)
+
+// UpdateLeaderboard records a score set by matchID at the given time on a
+// board, for all time and for the day, week and month it falls in. A user's
+// entry only ever goes up, so each board holds their personal best.
+func (c *RedisCache) UpdateLeaderboard(ctx context.Context, board models.Board, userID string, wpm int, matchID string, at time.Time) error {
+	record := matchRecord(matchID, at)
+	now := time.Now()
+
+	for _, period := range models.Periods {
+		start := period.Start(at)
+		expireAt := periodExpiry(period, start)
+		if !expireAt.IsZero() && !expireAt.After(now) {
+			continue
+		}
 
-	return err
+		key := leaderboardKey(board, period, start)
+		var expiry int64
+		if !expireAt.IsZero() {
+			expiry = expireAt.Unix()
+		}
+		err := personalBest.Run(ctx, c.client, []string{key, leaderboardMatchKey(key)}, wpm, userID, record, expiry).Err()
+		if err != nil {
+			return err
+		}
+
+		if period != models.AllTime {
+			index := periodIndexKey(period, start)
+			_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.SAdd(ctx, index, fmt.Sprintf("%s:%s:%d", board.Mode, board.Language, board.Duration))
+				pipe.ExpireAt(ctx, index, expireAt)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-// GetTopPlayers returns the top N players from the leaderboard
-func (c *RedisCache) GetTopPlayers(ctx context.Context, limit int64) ([]string, error) {
+// GetTopPlayers returns a page of a board for the period starting at start,
+// highest score first, and the number of players on it. Entries carry no
+// username; names can change, so they are looked up by the caller.
+func (c *RedisCache) GetTopPlayers(ctx context.Context, board models.Board, period models.Period, start time.Time, offset, limit int64) ([]models.LeaderboardEntry, int64, error) {
+	key := leaderboardKey(board, period, start)
+
 	// ZREVRANGE returns elements from high to low scores
-	result, err := c.client.ZRevRange(ctx, "leaderboard:global", 0, limit-1).Result()
-	return result, err
+	result, err := c.client.ZRevRangeWithScores(ctx, key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := c.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(result) == 0 {
+		return []models.LeaderboardEntry{}, total, nil
+	}
+
+	userIDs := make([]string, len(result))
+	for i, z := range result {
+		userIDs[i] = z.Member.(string)
+	}
+	records, err := c.client.HMGet(ctx, leaderboardMatchKey(key), userIDs...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]models.LeaderboardEntry, 0, len(result))
+	for i, z := range result {
+		entry := models.LeaderboardEntry{
+			Rank:   offset + int64(i) + 1,
+			UserID: userIDs[i],
+			WPM:    int(z.Score),
+		}
+		if record, ok := records[i].(string); ok {
+			entry.MatchID, entry.AchievedAt = parseMatchRecord(record)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
+
+// GetPlayerRank returns a user's placing on a board for the period starting
+// at start, or nil if they are not on it
+func (c *RedisCache) GetPlayerRank(ctx context.Context, board models.Board, period models.Period, start time.Time, userID string) (*models.LeaderboardEntry, error) {
+	key := leaderboardKey(board, period, start)
+
+	rank, err := c.client.ZRevRank(ctx, key, userID).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _, err := c.GetTopPlayers(ctx, board, period, start, rank, 1)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// GetPeriodBoards lists the boards that have scores in the period starting
+// at start
+func (c *RedisCache) GetPeriodBoards(ctx context.Context, period models.Period, start time.Time) ([]models.Board, error) {
+	members, err := c.client.SMembers(ctx, periodIndexKey(period, start)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	boards := make([]models.Board, 0, len(members))
+	for _, m := range members {
+		parts := strings.Split(m, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		duration, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		boards = append(boards, models.Board{Mode: parts[0], Language: parts[1], Duration: duration})
+	}
+	return boards, nil
+}
+
+// ClaimArchive marks a period as being archived and reports whether this
+// caller got there first, so that only one instance archives each period.
+func (c *RedisCache) ClaimArchive(ctx context.Context, period models.Period, start time.Time) (bool, error) {
+	key := fmt.Sprintf("leaderboard_archived:%s:%s", period, start.Format(time.DateOnly))
+	return c.client.SetNX(ctx, key, time.Now().Unix(), period.Next(start).Add(2*LeaderboardGrace).Sub(time.Now())).Result()
+}
+
+// ReleaseArchive undoes ClaimArchive after a failed attempt so it is retried
+func (c *RedisCache) ReleaseArchive(ctx context.Context, period models.Period, start time.Time) error {
+	key := fmt.Sprintf("leaderboard_archived:%s:%s", period, start.Format(time.DateOnly))
+	return c.client.Del(ctx, key).Err()
+}
+
+// LeaderboardRebuild collects the personal bests in a match history so that
+// every board can be rebuilt from scratch.
+type LeaderboardRebuild struct {
+	now    time.Time
+	boards map[string]*rebuiltBoard
+}
+
+type rebuiltBoard struct {
+	board    models.Board
+	expireAt time.Time
+	index    string // Period index the board belongs in, if any
+	member   string // The board's entry in that index
+	best     map[string]models.LeaderboardEntry
+}
+
+func NewLeaderboardRebuild() *LeaderboardRebuild {
+	return &LeaderboardRebuild{now: time.Now(), boards: make(map[string]*rebuiltBoard)}
+}
+
+// Add records a score the same way UpdateLeaderboard would
+func (b *LeaderboardRebuild) Add(board models.Board, userID string, wpm int, matchID string, at time.Time) {
+	for _, period := range models.Periods {
+		start := period.Start(at)
+		expireAt := periodExpiry(period, start)
+		if !expireAt.IsZero() && !expireAt.After(b.now) {
+			continue
+		}
+
+		key := leaderboardKey(board, period, start)
+		rb, ok := b.boards[key]
+		if !ok {
+			rb = &rebuiltBoard{board: board, expireAt: expireAt, best: make(map[string]models.LeaderboardEntry)}
+			if period != models.AllTime {
+				rb.index = periodIndexKey(period, start)
+				rb.member = fmt.Sprintf("%s:%s:%d", board.Mode, board.Language, board.Duration)
+			}
+			b.boards[key] = rb
+		}
+
+		// Ties go to whoever got there first, as with ZADD GT.
+		if cur, ok := rb.best[userID]; ok && (cur.WPM > wpm || (cur.WPM == wpm && !at.Before(cur.AchievedAt))) {
+			continue
+		}
+		rb.best[userID] = models.LeaderboardEntry{UserID: userID, WPM: wpm, MatchID: matchID, AchievedAt: at}
+	}
+}
+
+// ApplyLeaderboardRebuild replaces every board with the rebuilt one and
+// deletes boards that no longer have any scores. It returns the number of
+// boards written.
+func (c *RedisCache) ApplyLeaderboardRebuild(ctx context.Context, b *LeaderboardRebuild) (int, error) {
+	for key, rb := range b.boards {
+		tmp := key + ":rebuild"
+		_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			members := make([]redis.Z, 0, len(rb.best))
+			records := make(map[string]any, len(rb.best))
+			for userID, e := range rb.best {
+				members = append(members, redis.Z{Score: float64(e.WPM), Member: userID})
+				records[userID] = matchRecord(e.MatchID, e.AchievedAt)
+			}
+
+			pipe.Del(ctx, tmp, leaderboardMatchKey(tmp))
+			pipe.ZAdd(ctx, tmp, members...)
+			pipe.HSet(ctx, leaderboardMatchKey(tmp), records)
+			pipe.Rename(ctx, tmp, key)
+			pipe.Rename(ctx, leaderboardMatchKey(tmp), leaderboardMatchKey(key))
+			if !rb.expireAt.IsZero() {
+				pipe.ExpireAt(ctx, key, rb.expireAt)
+				pipe.ExpireAt(ctx, leaderboardMatchKey(key), rb.expireAt)
+				pipe.SAdd(ctx, rb.index, rb.member)
+				pipe.ExpireAt(ctx, rb.index, rb.expireAt)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Anything left over has no scores behind it, such as boards holding the
+	// old username:userID members.
+	iter := c.client.Scan(ctx, 0, "leaderboard:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if _, ok := b.boards[key]; ok {
+			continue
+		}
+		if err := c.client.Del(ctx, key, leaderboardMatchKey(key)).Err(); err != nil {
+			return 0, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+
+	return len(b.boards), nil
+}
+
+func matchRecord(matchID string, at time.Time) string {
+	return fmt.Sprintf("%s|%d", matchID, at.UnixMilli())
+}
+
+func parseMatchRecord(record string) (string, time.Time) {
+	matchID, ms, _ := strings.Cut(record, "|")
+	n, _ := strconv.ParseInt(ms, 10, 64)
+	return matchID, time.UnixMilli(n).UTC()
 }
 
 // CacheMatchHistory caches the recent match history for a user to reduce DB load
@@ -45,8 +320,112 @@ func (c *RedisCache) CacheMatchHistory(ctx context.Context, userID string, histo
 	return c.client.Set(ctx, key, historyJSON, 5*time.Minute).Err()
 }
 
-// GetCachedMatchHistory retrieves cached history
+// GetCachedMatchHistory retrieves cached history. It returns ErrCacheMiss on
+// a miss.
 func (c *RedisCache) GetCachedMatchHistory(ctx context.Context, userID string) (string, error) {
 	key := fmt.Sprintf("history:%s", userID)
-	return c.client.Get(ctx, key).Result()
+	return c.get(ctx, key)
+}
+
+// CacheUserStats caches a user's aggregated stats
+func (c *RedisCache) CacheUserStats(ctx context.Context, userID string, statsJSON []byte) error {
+	key := fmt.Sprintf("stats:%s", userID)
+	return c.client.Set(ctx, key, statsJSON, 5*time.Minute).Err()
+}
+
+// GetCachedUserStats retrieves cached stats. It returns ErrCacheMiss on a
+// miss.
+func (c *RedisCache) GetCachedUserStats(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("stats:%s", userID)
+	return c.get(ctx, key)
+}
+
+// InvalidateMatchCaches drops everything cached from a user's matches after
+// a new one is saved
+func (c *RedisCache) InvalidateMatchCaches(ctx context.Context, userID string) error {
+	return c.client.Del(ctx, fmt.Sprintf("history:%s", userID), fmt.Sprintf("stats:%s", userID)).Err()
+}
+
+// CreateSession records a login session that expires after ttl
+func (c *RedisCache) CreateSession(ctx context.Context, sessionID string, userID string, ttl time.Duration) error {
+	key := fmt.Sprintf("session:%s", sessionID)
+	return c.client.Set(ctx, key, userID, ttl).Err()
+}
+
+// GetSession returns the user a live session belongs to, or ErrCacheMiss
+// once it has ended
+func (c *RedisCache) GetSession(ctx context.Context, sessionID string) (string, error) {
+	key := fmt.Sprintf("session:%s", sessionID)
+	return c.get(ctx, key)
+}
+
+// DeleteSession ends a session
+func (c *RedisCache) DeleteSession(ctx context.Context, sessionID string) error {
+	key := fmt.Sprintf("session:%s", sessionID)
+	return c.client.Del(ctx, key).Err()
+}
+
+// SaveRace stores a room's race state, replacing any earlier state, for ttl
+func (c *RedisCache) SaveRace(ctx context.Context, race *models.RaceSnapshot, ttl time.Duration) error {
+	data, err := json.Marshal(race)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, fmt.Sprintf("race:%s", race.RoomID), data, ttl).Err()
+}
+
+// GetRace returns a room's saved race state, or nil if it has none
+func (c *RedisCache) GetRace(ctx context.Context, roomID string) (*models.RaceSnapshot, error) {
+	val, err := c.get(ctx, fmt.Sprintf("race:%s", roomID))
+	if err == ErrCacheMiss {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var race models.RaceSnapshot
+	if err := json.Unmarshal([]byte(val), &race); err != nil {
+		return nil, err
+	}
+	return &race, nil
+}
+
+// DeleteRace drops a room's race state once the room is empty
+func (c *RedisCache) DeleteRace(ctx context.Context, roomID string) error {
+	return c.client.Del(ctx, fmt.Sprintf("race:%s", roomID)).Err()
+}
+
+// IssuePassage records the test a user was set, replacing any earlier one,
+// for ttl
+func (c *RedisCache) IssuePassage(ctx context.Context, userID string, test models.IssuedTest, ttl time.Duration) error {
+	data, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, fmt.Sprintf("passage:%s", userID), data, ttl).Err()
+}
+
+// TakePassage returns and forgets the test a user was last set, or
+// ErrCacheMiss if there is none
+func (c *RedisCache) TakePassage(ctx context.Context, userID string) (*models.IssuedTest, error) {
+	val, err := c.client.GetDel(ctx, fmt.Sprintf("passage:%s", userID)).Result()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var test models.IssuedTest
+	if err := json.Unmarshal([]byte(val), &test); err != nil {
+		return nil, err
+	}
+	return &test, nil
+}
+
+func (c *RedisCache) get(ctx context.Context, key string) (string, error) {
+	val, err := c.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return val, err
 }
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// GetUserStats aggregates a user's matches, with a daily trend over the last
+// trendDays days. With verifiedOnly, only matches whose keystrokes backed up
+// the result are counted.
+func (r *MatchRepository) GetUserStats(ctx context.Context, userID string, trendDays int, verifiedOnly bool) (*models.UserStats, error) {
+	stats := &models.UserStats{
+		UserID:        userID,
+		PersonalBests: []models.PersonalBest{},
+		Trend:         []models.TrendPoint{},
+	}
+	scope := "user_id = $1"
+	if verifiedOnly {
+		scope += " AND verification = 'verified'"
+	}
+
+	totals := `
+		SELECT COUNT(*),
+		       COALESCE(ROUND(AVG(wpm), 1), 0),
+		       COALESCE(MAX(wpm) FILTER (WHERE verification = 'verified'), 0),
+		       COALESCE(ROUND(AVG(accuracy), 1), 0),
+		       COALESCE(SUM(duration_seconds), 0),
+		       MIN(created_at),
+		       MAX(created_at)
+		FROM matches
+		WHERE ` + scope
+	err := r.db.QueryRow(ctx, totals, userID).Scan(
+		&stats.TotalMatches, &stats.AvgWPM, &stats.MaxWPM, &stats.AvgAccuracy,
+		&stats.TotalTimeSeconds, &stats.FirstMatchAt, &stats.LastMatchAt,
+	)
+	if err != nil || stats.TotalMatches == 0 {
+		return stats, err
+	}
+
+	if err := r.personalBests(ctx, stats); err != nil {
+		return nil, err
+	}
+	if err := r.trend(ctx, stats, scope, trendDays); err != nil {
+		return nil, err
+	}
+	if err := r.streak(ctx, stats, scope); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *MatchRepository) personalBests(ctx context.Context, stats *models.UserStats) error {
+	query := `
+		SELECT DISTINCT ON (mode, duration_seconds)
+		       mode, duration_seconds, wpm, accuracy, id, created_at
+		FROM matches
+		WHERE user_id = $1 AND verification = 'verified'
+		ORDER BY mode, duration_seconds, wpm DESC, created_at
+	`
+	rows, err := r.db.Query(ctx, query, stats.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pb models.PersonalBest
+		if err := rows.Scan(&pb.Mode, &pb.Duration, &pb.WPM, &pb.Accuracy, &pb.MatchID, &pb.AchievedAt); err != nil {
+			return err
+		}
+		stats.PersonalBests = append(stats.PersonalBests, pb)
+	}
+	return rows.Err()
+}
+
+func (r *MatchRepository) trend(ctx context.Context, stats *models.UserStats, scope string, days int) error {
+	query := `
+		SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+		       COUNT(*),
+		       ROUND(AVG(wpm), 1),
+		       ROUND(AVG(accuracy), 1)
+		FROM matches
+		WHERE ` + scope + ` AND created_at >= $2
+		GROUP BY day
+		ORDER BY day
+	`
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	rows, err := r.db.Query(ctx, query, stats.UserID, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.TrendPoint
+		var day time.Time
+		if err := rows.Scan(&day, &p.Matches, &p.AvgWPM, &p.AvgAccuracy); err != nil {
+			return err
+		}
+		p.Date = day.Format(time.DateOnly)
+		stats.Trend = append(stats.Trend, p)
+	}
+	return rows.Err()
+}
+
+func (r *MatchRepository) streak(ctx context.Context, stats *models.UserStats, scope string) error {
+	// Consecutive days share the same day minus row number.
+	query := `
+		WITH days AS (
+			SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date AS day
+			FROM matches
+			WHERE ` + scope + `
+		), runs AS (
+			SELECT day, day - (ROW_NUMBER() OVER (ORDER BY day))::int AS run
+			FROM days
+		)
+		SELECT COUNT(*), MAX(day)
+		FROM runs
+		GROUP BY run
+		ORDER BY MAX(day) DESC
+	`
+	rows, err := r.db.Query(ctx, query, stats.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	first := true
+	for rows.Next() {
+		var length int
+		var lastDay time.Time
+		if err := rows.Scan(&length, &lastDay); err != nil {
+			return err
+		}
+		if first {
+			stats.Streak.LastActive = lastDay.Format(time.DateOnly)
+			if stats.Streak.LastActive >= yesterday {
+				stats.Streak.Current = length
+			}
+			first = false
+		}
+		stats.Streak.Longest = max(stats.Streak.Longest, length)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/game"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCacheMiss is returned for cache entries and sessions that do not exist
+// or have expired
+var ErrCacheMiss = errors.New("cache miss")
+
+// ErrInvalidCursor is returned by ListMatches for a cursor that does not name
+// one of the user's matches
+var ErrInvalidCursor = errors.New("cursor does not name one of the user's matches")
+
+// MatchStore saves match results and answers queries over them
+type MatchStore interface {
+	CreateMatch(ctx context.Context, match *models.MatchResult) error
+	ListMatches(ctx context.Context, f models.MatchFilter) ([]*models.MatchResult, error)
+	ForEachRankedMatch(ctx context.Context, since time.Time, fn func(m *models.MatchResult, playedAt time.Time) error) error
+	GetUserStats(ctx context.Context, userID string, trendDays int, verifiedOnly bool) (*models.UserStats, error)
+	GetKeyAnalytics(ctx context.Context, userID string, from, to *time.Time) (*models.KeyAnalytics, error)
+}
+
+// UserStore holds guest and registered accounts
+type UserStore interface {
+	GetUser(ctx context.Context, id string) (string, error)
+	GetUsernames(ctx context.Context, ids []string) (map[string]string, error)
+	CreateGuestAccount(ctx context.Context, username string) (*models.User, error)
+	CreateUser(ctx context.Context, username, email, passwordHash string) (*models.User, error)
+	UpgradeGuest(ctx context.Context, id, username, email, passwordHash string) (*models.User, error)
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	GetCredentials(ctx context.Context, email string) (*models.User, string, error)
+}
+
+// LeaderboardStore holds the live leaderboards for every period
+type LeaderboardStore interface {
+	UpdateLeaderboard(ctx context.Context, board models.Board, userID string, wpm int, matchID string, at time.Time) error
+	GetTopPlayers(ctx context.Context, board models.Board, period models.Period, start time.Time, offset, limit int64) ([]models.LeaderboardEntry, int64, error)
+	GetPlayerRank(ctx context.Context, board models.Board, period models.Period, start time.Time, userID string) (*models.LeaderboardEntry, error)
+	GetPeriodBoards(ctx context.Context, period models.Period, start time.Time) ([]models.Board, error)
+	ClaimArchive(ctx context.Context, period models.Period, start time.Time) (bool, error)
+	ReleaseArchive(ctx context.Context, period models.Period, start time.Time) error
+	ApplyLeaderboardRebuild(ctx context.Context, b *LeaderboardRebuild) (int, error)
+}
+
+// LeaderboardArchive keeps the final standings of periods that have ended
+type LeaderboardArchive interface {
+	ArchiveBoard(ctx context.Context, board models.Board, period models.Period, start time.Time, entries []models.LeaderboardEntry) error
+	GetArchive(ctx context.Context, board models.Board, period models.Period, start time.Time, limit int) ([]*models.ArchivedEntry, error)
+}
+
+// ResultCache caches responses computed from a user's matches
+type ResultCache interface {
+	CacheMatchHistory(ctx context.Context, userID string, historyJSON []byte) error
+	GetCachedMatchHistory(ctx context.Context, userID string) (string, error)
+	CacheUserStats(ctx context.Context, userID string, statsJSON []byte) error
+	GetCachedUserStats(ctx context.Context, userID string) (string, error)
+	InvalidateMatchCaches(ctx context.Context, userID string) error
+}
+
+// SessionStore records which login sessions are live
+type SessionStore interface {
+	CreateSession(ctx context.Context, sessionID string, userID string, ttl time.Duration) error
+	GetSession(ctx context.Context, sessionID string) (string, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+// AchievementStore holds unlocked achievements and XP
+type AchievementStore interface {
+	GetUnlocked(ctx context.Context, userID string) (map[string]time.Time, error)
+	Unlock(ctx context.Context, userID, matchID string, ids []string) (map[string]time.Time, error)
+	GetXP(ctx context.Context, userID string) (int64, int, error)
+	AddXP(ctx context.Context, userID string, xp int64, levelFor func(int64) int) (int64, error)
+}
+
+// PassageStore remembers the passage last issued to each user for solo play,
+// with the test it is for, so that a result can be checked against the text
+// the server chose and recorded as that test. TakePassage hands it out once
+// and returns ErrCacheMiss when there is none.
+type PassageStore interface {
+	IssuePassage(ctx context.Context, userID string, test models.IssuedTest, ttl time.Duration) error
+	TakePassage(ctx context.Context, userID string) (*models.IssuedTest, error)
+}
+
+// Stores are the storage backends the server runs on
+type Stores struct {
+	Matches      MatchStore
+	Users        UserStore
+	Leaderboards LeaderboardStore
+	Archive      LeaderboardArchive
+	Cache        ResultCache
+	Sessions     SessionStore
+	Achievements AchievementStore
+	Races        game.RaceStore
+	Passages     PassageStore
+}
+
+// NewStores backs every store with PostgreSQL and Redis
+func NewStores(db *pgxpool.Pool, rdb *redis.Client) Stores {
+	cache := NewRedisCache(rdb)
+	return Stores{
+		Matches:      NewMatchRepository(db),
+		Users:        NewUserRepository(db),
+		Leaderboards: cache,
+		Archive:      NewLeaderboardRepository(db),
+		Cache:        cache,
+		Sessions:     cache,
+		Achievements: NewAchievementRepository(db),
+		Races:        cache,
+		Passages:     cache,
+	}
+}
+
+// NewMemoryStores keeps everything in process memory, for tests and for
+// running without PostgreSQL or Redis
+func NewMemoryStores() Stores {
+	cache := NewMemoryCache()
+	return Stores{
+		Matches:      NewMemoryMatchStore(),
+		Users:        NewMemoryUserStore(),
+		Leaderboards: NewMemoryLeaderboardStore(),
+		Archive:      NewMemoryLeaderboardArchive(),
+		Cache:        cache,
+		Sessions:     cache,
+		Achievements: NewMemoryAchievementStore(),
+		Races:        cache,
+		Passages:     cache,
+	}
+}
+
+var (
+	_ MatchStore         = (*MatchRepository)(nil)
+	_ UserStore          = (*UserRepository)(nil)
+	_ LeaderboardStore   = (*RedisCache)(nil)
+	_ LeaderboardArchive = (*LeaderboardRepository)(nil)
+	_ ResultCache        = (*RedisCache)(nil)
+	_ SessionStore       = (*RedisCache)(nil)
+	_ AchievementStore   = (*AchievementRepository)(nil)
+	_ game.RaceStore     = (*RedisCache)(nil)
+	_ PassageStore       = (*RedisCache)(nil)
+)
@@ -2,9 +2,19 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUsernameTaken = errors.New("username is already taken")
+	ErrEmailTaken    = errors.New("email is already registered")
 )
 
 type UserRepository struct {
@@ -15,19 +25,127 @@ func NewUserRepository(db *pgxpool.Pool) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) CreateGuest(ctx context.Context, id string, username string) error {
-	query := `
-		INSERT INTO users (id, username, is_guest, created_at, updated_at)
-		VALUES ($1, $2, TRUE, $3, $3)
-		ON CONFLICT (id) DO NOTHING
-	`
-	_, err := r.db.Exec(ctx, query, id, username, time.Now())
-	return err
-}
-
 func (r *UserRepository) GetUser(ctx context.Context, id string) (string, error) {
 	var username string
 	query := `SELECT username FROM users WHERE id = $1`
 	err := r.db.QueryRow(ctx, query, id).Scan(&username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
 	return username, err
 }
+
+// GetUsernames returns the current usernames of the given users, keyed by ID
+func (r *UserRepository) GetUsernames(ctx context.Context, ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT id, username FROM users WHERE id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		names[id] = username
+	}
+	return names, rows.Err()
+}
+
+// CreateGuestAccount inserts a guest with a server-assigned ID
+func (r *UserRepository) CreateGuestAccount(ctx context.Context, username string) (*models.User, error) {
+	query := `
+		INSERT INTO users (username, is_guest, created_at, updated_at)
+		VALUES ($1, TRUE, $2, $2)
+		RETURNING id, username, '', is_guest, created_at
+	`
+	user, err := scanUser(r.db.QueryRow(ctx, query, username, time.Now()))
+	return user, uniqueViolation(err)
+}
+
+// CreateUser inserts a registered account
+func (r *UserRepository) CreateUser(ctx context.Context, username, email, passwordHash string) (*models.User, error) {
+	query := `
+		INSERT INTO users (username, email, password_hash, is_guest, created_at, updated_at)
+		VALUES ($1, $2, $3, FALSE, $4, $4)
+		RETURNING id, username, email, is_guest, created_at
+	`
+	row := r.db.QueryRow(ctx, query, username, email, passwordHash, time.Now())
+	user, err := scanUser(row)
+	return user, uniqueViolation(err)
+}
+
+// UpgradeGuest turns a guest into a registered account in place, so that its
+// match history carries over. It returns ErrUserNotFound if id is not a guest.
+func (r *UserRepository) UpgradeGuest(ctx context.Context, id, username, email, passwordHash string) (*models.User, error) {
+	query := `
+		UPDATE users
+		SET username = $2, email = $3, password_hash = $4, is_guest = FALSE, updated_at = $5
+		WHERE id = $1 AND is_guest
+		RETURNING id, username, email, is_guest, created_at
+	`
+	row := r.db.QueryRow(ctx, query, id, username, email, passwordHash, time.Now())
+	user, err := scanUser(row)
+	return user, uniqueViolation(err)
+}
+
+// GetUserByID returns an account by its ID
+func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	query := `
+		SELECT id, username, COALESCE(email, ''), COALESCE(is_guest, FALSE), created_at
+		FROM users WHERE id = $1
+	`
+	return scanUser(r.db.QueryRow(ctx, query, id))
+}
+
+// GetCredentials returns a registered account and its password hash by email
+func (r *UserRepository) GetCredentials(ctx context.Context, email string) (*models.User, string, error) {
+	query := `
+		SELECT id, username, email, is_guest, created_at, password_hash
+		FROM users WHERE email = $1 AND NOT COALESCE(is_guest, FALSE)
+	`
+	var u models.User
+	var hash string
+	err := r.db.QueryRow(ctx, query, email).Scan(&u.ID, &u.Username, &u.Email, &u.IsGuest, &u.CreatedAt, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &u, hash, nil
+}
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.IsGuest, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// uniqueViolation maps a clash on the username or email constraint to the
+// matching error.
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "users_username_key":
+		return ErrUsernameTaken
+	case "users_email_key":
+		return ErrEmailTaken
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// handleGetAchievements returns a user's XP, level and achievements
+func (s *Server) handleGetAchievements(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if !uuidPattern.MatchString(userID) {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	progress, err := s.achievements.Progress(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching achievements for %s: %v", userID, err)
+		http.Error(w, "failed to fetch achievements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// handleGetKeyAnalytics returns per-key and per-bigram error rates for a
+// user, optionally limited to matches between from and to.
+func (s *Server) handleGetKeyAnalytics(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	userID := q.Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if !uuidPattern.MatchString(userID) {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeParam(q.Get("from"))
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"))
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	analytics, err := s.matches.GetKeyAnalytics(r.Context(), userID, optionalTime(from), optionalTime(to))
+	if err != nil {
+		log.Printf("Error computing key analytics for %s: %v", userID, err)
+		http.Error(w, "failed to fetch key analytics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analytics)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+const (
+	archiveInterval = 5 * time.Minute
+
+	// Only the top of each board is worth keeping once its period is over.
+	archiveDepth = 100
+)
+
+// runLeaderboardArchiver copies the final standings of every finished day,
+// week and month into Postgres. Each period is archived once across all
+// instances; a period missed during downtime is picked up as long as its
+// boards are still within their grace period in Redis.
+func (s *Server) runLeaderboardArchiver() {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		s.archiveFinishedPeriods(context.Background(), time.Now())
+		<-ticker.C
+	}
+}
+
+func (s *Server) archiveFinishedPeriods(ctx context.Context, now time.Time) {
+	oldest := now.Add(-repository.LeaderboardGrace)
+
+	for _, period := range models.Periods {
+		if period == models.AllTime {
+			continue
+		}
+
+		// Walk back through finished periods whose boards may still exist.
+		for start := period.Start(period.Start(now).Add(-time.Nanosecond)); period.Next(start).After(oldest); start = period.Start(start.Add(-time.Nanosecond)) {
+			claimed, err := s.leaderboards.ClaimArchive(ctx, period, start)
+			if err != nil {
+				log.Printf("Error claiming %s leaderboard archive for %s: %v", period, start.Format(time.DateOnly), err)
+				return
+			}
+			if !claimed {
+				continue
+			}
+
+			if err := s.archivePeriod(ctx, period, start); err != nil {
+				log.Printf("Error archiving %s leaderboards for %s: %v", period, start.Format(time.DateOnly), err)
+				if err := s.leaderboards.ReleaseArchive(ctx, period, start); err != nil {
+					log.Printf("Error releasing leaderboard archive claim: %v", err)
+				}
+				continue
+			}
+			log.Printf("Archived %s leaderboards for %s", period, start.Format(time.DateOnly))
+		}
+	}
+}
+
+func (s *Server) archivePeriod(ctx context.Context, period models.Period, start time.Time) error {
+	boards, err := s.leaderboards.GetPeriodBoards(ctx, period, start)
+	if err != nil {
+		return err
+	}
+
+	for _, board := range boards {
+		entries, _, err := s.leaderboards.GetTopPlayers(ctx, board, period, start, 0, archiveDepth)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		if err := s.withUsernames(ctx, entries); err != nil {
+			return err
+		}
+		if err := s.archive.ArchiveBoard(ctx, board, period, start, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
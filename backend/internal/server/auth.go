@@ -0,0 +1,240 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 50
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type sessionResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"`
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	c.Username = strings.TrimSpace(c.Username)
+	c.Email = normalizeEmail(c.Email)
+
+	if n := utf8.RuneCountInString(c.Username); n < minUsernameLength || n > maxUsernameLength {
+		http.Error(w, "username must be between 3 and 50 characters", http.StatusBadRequest)
+		return
+	}
+	if _, err := mail.ParseAddress(c.Email); err != nil {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+	if err := auth.ValidatePassword(c.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(c.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "failed to register", http.StatusInternalServerError)
+		return
+	}
+
+	// Registering from a guest session upgrades that guest in place, so its
+	// match history is kept.
+	var user *models.User
+	err = repository.ErrUserNotFound
+	if guest, authErr := s.authenticate(r); authErr == nil {
+		user, err = s.users.UpgradeGuest(r.Context(), guest.UserID, c.Username, c.Email, hash)
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		user, err = s.users.CreateUser(r.Context(), c.Username, c.Email, hash)
+	}
+	switch {
+	case errors.Is(err, repository.ErrUsernameTaken), errors.Is(err, repository.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error registering user: %v", err)
+		http.Error(w, "failed to register", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s registered", user.ID)
+	s.startSession(w, r, user, http.StatusCreated)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, hash, err := s.users.GetCredentials(r.Context(), normalizeEmail(c.Email))
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		log.Printf("Error looking up user: %v", err)
+		http.Error(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+	// Always compare, so unknown emails cannot be told apart by timing.
+	if !auth.CheckPassword(hash, c.Password) || user == nil {
+		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	s.startSession(w, r, user, http.StatusOK)
+}
+
+// handleGuest creates a guest account and a session for it, so that guests
+// play under a server-assigned identity like everyone else.
+func (s *Server) handleGuest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var c credentials
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	username := strings.TrimSpace(c.Username)
+	if n := utf8.RuneCountInString(username); n < minUsernameLength || n > maxUsernameLength {
+		username = randomGuestName()
+	}
+
+	user, err := s.users.CreateGuestAccount(r.Context(), username)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		user, err = s.users.CreateGuestAccount(r.Context(), randomGuestName())
+	}
+	if err != nil {
+		log.Printf("Error creating guest: %v", err)
+		http.Error(w, "failed to create guest", http.StatusInternalServerError)
+		return
+	}
+
+	s.startSession(w, r, user, http.StatusCreated)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := auth.BearerToken(r.Header.Get("Authorization"))
+	if err := s.sessions.Revoke(r.Context(), token); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error revoking session: %v", err)
+		http.Error(w, "failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe returns the account the request's session token belongs to
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.authenticate(r)
+	if err != nil {
+		http.Error(w, auth.ErrInvalidToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.users.GetUserByID(r.Context(), identity.UserID)
+	if err != nil {
+		log.Printf("Error fetching user %s: %v", identity.UserID, err)
+		http.Error(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *models.User, status int) {
+	token, claims, err := s.sessions.Issue(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error creating session for %s: %v", user.ID, err)
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sessionResponse{
+		Token:     token,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+		User:      user,
+	})
+}
+
+// authenticate resolves the session token on a request, taken from the
+// Authorization header or, for browsers opening a WebSocket, the token query
+// parameter.
+func (s *Server) authenticate(r *http.Request) (auth.Identity, error) {
+	token := auth.BearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	claims, err := s.sessions.Verify(r.Context(), token)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	username, err := s.users.GetUser(r.Context(), claims.UserID)
+	if err != nil {
+		return auth.Identity{}, err
+	}
+	return auth.Identity{UserID: claims.UserID, Username: username}, nil
+}
+
+func randomGuestName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "Guest_" + hex.EncodeToString(b)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
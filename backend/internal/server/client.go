@@ -1,40 +1,40 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
 )
 
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
-)
-
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan []byte
+
+	// The authenticated user behind the connection, fixed at upgrade.
+	identity auth.Identity
+
+	// The protocol version and features agreed in the handshake.
+	protocol models.WelcomePayload
+
+	// The session the connection belongs to. Only touched from the hub
+	// goroutine.
+	session *session
+
+	// The room the client last joined. Only touched from the readPump
+	// goroutine.
+	roomID string
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -43,13 +43,16 @@ type Client struct {
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
 func (c *Client) readPump() {
+	// The client keeps its room and race place when the connection drops;
+	// the hub gives them up if it does not resume in time.
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	limits := c.hub.limits
+	c.conn.SetReadLimit(limits.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(limits.PongWait))
+	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(limits.PongWait)); return nil })
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -58,18 +61,173 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		c.hub.handler.HandleEvent(message)
-		c.hub.broadcast <- message
+		if err := c.route(message); err != nil {
+			c.refuse(message, err)
+		}
 	}
 }
 
+// route handles an event from the client: it updates the client's room and
+// race, and tells the room what happened through events the server builds
+// itself. Nothing the client sent is passed on as is.
+func (c *Client) route(message []byte) error {
+	var event models.WSEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		return &protocol.EventError{Code: models.CodeBadMessage, Message: "message is not a JSON event"}
+	}
+	payload, err := protocol.Decode(c.protocol.Version, event)
+	if err != nil {
+		return err
+	}
+	handler := c.hub.handler
+
+	switch p := payload.(type) {
+	case *models.JoinLobbyPayload:
+		if err := handler.JoinLobby(c.identity, p); err != nil {
+			return err
+		}
+		// Rejoining the same room, as a resumed client may, keeps its place
+		// in the race.
+		if c.roomID != "" && c.roomID != p.RoomID {
+			c.leaveRoom()
+		}
+		c.roomID = p.RoomID
+		c.hub.join <- &membership{client: c, roomID: c.roomID}
+		c.hub.races.Join(c.roomID, c.identity.UserID, c.identity.Username)
+		c.broadcast(models.EventPlayerJoined, c.player())
+
+	case *models.LeaveLobbyPayload:
+		if c.roomID == "" {
+			return errNotInRoom
+		}
+		c.leaveRoom()
+		c.hub.leave <- c
+		c.roomID = ""
+
+	case *models.PlayerReadyPayload:
+		if c.roomID == "" {
+			return errNotInRoom
+		}
+		c.hub.races.Ready(c.roomID, c.identity.UserID)
+		c.broadcast(models.EventPlayerReady, c.player())
+
+	case *models.TypingPayload:
+		if err := handler.TypingUpdate(c.identity, p); err != nil {
+			return err
+		}
+		if c.roomID == "" {
+			return errNotInRoom
+		}
+		c.hub.races.Progress(c.roomID, c.identity.UserID, p.Progress, p.WPM)
+		c.broadcast(models.EventProgress, models.ProgressPayload{
+			RoomID:   c.roomID,
+			UserID:   c.identity.UserID,
+			Username: c.identity.Username,
+			WPM:      p.WPM,
+			Accuracy: p.Accuracy,
+			Progress: p.Progress,
+		})
+
+	case *models.ChatMessagePayload:
+		if err := handler.ChatMessage(c.identity, p); err != nil {
+			return err
+		}
+		if c.roomID == "" {
+			return errNotInRoom
+		}
+		c.broadcast(models.EventChat, models.ChatPayload{
+			RoomID:   c.roomID,
+			UserID:   c.identity.UserID,
+			Username: c.identity.Username,
+			Message:  p.Message,
+			SentAt:   time.Now().UnixMilli(),
+		})
+
+	case *models.GameEndPayload:
+		var race *models.IssuedTest
+		if c.roomID != "" {
+			if test, ok := c.hub.races.Test(c.roomID, c.identity.UserID); ok {
+				race = &test
+			}
+		}
+		match, err := handler.GameEnd(c.identity, race, p)
+		if err != nil {
+			return err
+		}
+		result := models.RaceResultPayload{
+			RoomID:       c.roomID,
+			UserID:       c.identity.UserID,
+			Username:     c.identity.Username,
+			WPM:          match.WPM,
+			Accuracy:     match.Accuracy,
+			Verification: match.Verification,
+		}
+		if c.roomID == "" {
+			c.hub.sendTo(c, encodeEvent(models.EventRaceResult, result))
+			return nil
+		}
+		// The race ranks the result as the server saw it, not as claimed, and
+		// only if the keystrokes backed it up.
+		ranked := match.Verification == string(anticheat.Verified)
+		c.hub.races.Finish(c.roomID, c.identity.UserID, match.WPM, match.Accuracy, ranked)
+		c.broadcast(models.EventRaceResult, result)
+
+	}
+	return nil
+}
+
+var errNotInRoom = &protocol.EventError{Code: models.CodeNotInRoom, Message: "join a room first"}
+
+// leaveRoom tells the client's room it is leaving and takes it out of the
+// room's race. Membership in the hub is left to the caller.
+func (c *Client) leaveRoom() {
+	c.broadcast(models.EventPlayerLeft, c.player())
+	c.hub.races.Leave(c.roomID, c.identity.UserID)
+}
+
+func (c *Client) player() models.PlayerPayload {
+	return models.PlayerPayload{RoomID: c.roomID, UserID: c.identity.UserID, Username: c.identity.Username}
+}
+
+// broadcast sends a server event to every member of the client's room.
+func (c *Client) broadcast(eventType models.EventType, payload any) {
+	if data := encodeEvent(eventType, payload); data != nil {
+		c.hub.relayFrom(c, data)
+	}
+}
+
+// refuse sends the client an error event for a message route turned down,
+// if it asked for them.
+func (c *Client) refuse(message []byte, err error) {
+	if !c.accepts(protocol.FeatureErrors) {
+		return
+	}
+	var refused *protocol.EventError
+	if !errors.As(err, &refused) {
+		refused = &protocol.EventError{Code: models.CodeInternal, Message: "internal error"}
+	}
+	payload := models.ErrorPayload{Code: refused.Code, Message: refused.Message}
+
+	var event models.WSEvent
+	if json.Unmarshal(message, &event) == nil {
+		payload.Event = event.Type
+	}
+	c.hub.sendTo(c, encodeEvent(models.EventError, payload))
+}
+
+// accepts reports whether the client asked for a protocol feature.
+func (c *Client) accepts(feature string) bool {
+	return slices.Contains(c.protocol.Features, feature)
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
 // A goroutine running writePump is started for each connection. The
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	writeWait := c.hub.limits.WriteWait
+	ticker := time.NewTicker(c.hub.limits.PingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -83,18 +241,9 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			// Each event is a frame of its own: clients parse every frame as
+			// one JSON event.
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -106,15 +255,38 @@ func (c *Client) writePump() {
 	}
 }
 
-// ServeWs handles websocket requests from the peer.
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// ServeWs handles websocket requests from a peer that has already been
+// authenticated as identity. The peer opens with a hello; see handshake. A
+// peer reconnecting after a drop passes the token from its session event and
+// the seq of the last event it saw as the resume and last_seq query
+// parameters.
+func ServeWs(hub *Hub, identity auth.Identity, w http.ResponseWriter, r *http.Request) {
+	lastSeq, _ := strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
-	client.hub.register <- client
+	welcome, err := handshake(conn, hub.limits.HandshakeWait, hub.limits.WriteWait)
+	if err != nil {
+		log.Printf("Handshake with %s failed: %v", identity.UserID, err)
+		conn.Close()
+		return
+	}
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, hub.limits.SendBuffer), identity: identity, protocol: welcome}
+
+	reg := &registration{client: client, lastSeq: lastSeq, done: make(chan struct{})}
+	if client.accepts(protocol.FeatureResume) {
+		reg.token = r.URL.Query().Get("resume")
+	}
+	hub.register <- reg
+	<-reg.done
+	if reg.roomID != "" {
+		// Back in the room it left; rejoining its race sends everyone the
+		// race's current state.
+		client.roomID = reg.roomID
+		hub.races.Join(client.roomID, identity.UserID, identity.Username)
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// testConn is a game client speaking the protocol over a real WebSocket
+type testConn struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dial(t *testing.T, url, token string) *testConn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn}
+}
+
+func (c *testConn) send(eventType models.EventType, payload any) {
+	c.t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.conn.WriteJSON(models.WSEvent{Type: eventType, Payload: data}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads events until one of eventType arrives and decodes its payload
+// into v. An error event fails the test.
+func (c *testConn) expect(eventType models.EventType, v any) {
+	c.t.Helper()
+	c.expectAll(map[models.EventType]any{eventType: v})
+}
+
+// expectAll is expect for several events that may arrive in any order
+func (c *testConn) expectAll(want map[models.EventType]any) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for len(want) > 0 {
+		var event models.WSEvent
+		if err := c.conn.ReadJSON(&event); err != nil {
+			c.t.Fatalf("waiting for %d events: %v", len(want), err)
+		}
+		v, ok := want[event.Type]
+		if event.Type == models.EventError && !ok {
+			c.t.Fatalf("got error %s", event.Payload)
+		}
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(event.Payload, v); err != nil {
+			c.t.Fatalf("decoding %s: %v", event.Type, err)
+		}
+		delete(want, event.Type)
+	}
+}
+
+func TestRace(t *testing.T) {
+	_, ts := newTestServer(t, repository.NewMemoryStores())
+	user, token := newGuest(t, ts)
+	c := dial(t, ts.URL, token)
+	const roomID = "test_room"
+
+	c.send(models.EventHello, models.HelloPayload{Version: protocol.Current, Features: []string{protocol.FeatureResume, protocol.FeatureErrors}})
+	var welcome models.WelcomePayload
+	c.expect(models.EventWelcome, &welcome)
+	if welcome.Version != protocol.Current || len(welcome.Features) != 2 {
+		t.Fatalf("welcome: %+v", welcome)
+	}
+	var session models.SessionPayload
+	c.expect(models.EventSession, &session)
+	if session.Token == "" || session.Resumed {
+		t.Fatalf("session: %+v", session)
+	}
+
+	c.send(models.EventJoinLobby, models.JoinLobbyPayload{RoomID: roomID})
+	var joined models.PlayerPayload
+	c.expect(models.EventPlayerJoined, &joined)
+	if joined.UserID != user.ID || joined.RoomID != roomID {
+		t.Fatalf("player_joined: %+v", joined)
+	}
+
+	// The only member being ready starts the countdown
+	c.send(models.EventPlayerReady, struct{}{})
+	var start models.GameStartPayload
+	c.expect(models.EventGameStart, &start)
+	if start.Text != start.Passage.Text() {
+		t.Fatal("game_start text does not match its passage")
+	}
+	time.Sleep(time.Until(time.UnixMilli(start.StartAt)) + 100*time.Millisecond)
+
+	// A log that takes longer than the race has run is refused, leaving the
+	// racer in the race
+	c.send(models.EventGameEnd, gameEnd(start.Passage, 30))
+	var refused models.ErrorPayload
+	c.expect(models.EventError, &refused)
+	if refused.Code != models.CodeRejected || refused.Event != models.EventGameEnd {
+		t.Fatalf("error: %+v", refused)
+	}
+
+	time.Sleep(3 * time.Second)
+	c.send(models.EventGameEnd, gameEnd(start.Passage, 3))
+	// The race may end before or after the result is announced
+	var result models.RaceResultPayload
+	var results models.GameResultsPayload
+	c.expectAll(map[models.EventType]any{models.EventRaceResult: &result, models.EventGameResults: &results})
+	if result.UserID != user.ID || result.Verification != "verified" || result.WPM == 0 {
+		t.Fatalf("race_result: %+v", result)
+	}
+
+	if len(results.Standings) != 1 {
+		t.Fatalf("game_results: %d standings, want 1", len(results.Standings))
+	}
+	if s := results.Standings[0]; s.UserID != user.ID || s.Rank != 1 || !s.Finished || s.WPM != result.WPM {
+		t.Fatalf("game_results standing: %+v", s)
+	}
+
+	// Saved as a race, whatever mode the client named
+	resp, err := http.Get(ts.URL + "/api/history?user_id=" + user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var matches []*models.MatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Mode != models.ModeRace || matches[0].WPM != result.WPM {
+		t.Fatalf("history: %+v", matches)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/origin"
+)
+
+// allowOrigin reports whether a browser request may come from its Origin:
+// one on the allowed_origins list, or the backend's own
+func (s *Server) allowOrigin(r *http.Request) bool {
+	return s.origins.Allowed(r.Header.Get("Origin")) || origin.SameOrigin(r)
+}
+
+// checkOrigin accepts WebSocket upgrades from allowed origins, and from
+// clients that send no Origin header, which are not browsers
+func (s *Server) checkOrigin(r *http.Request) bool {
+	if r.Header.Get("Origin") == "" || s.allowOrigin(r) {
+		return true
+	}
+	log.Printf("Rejected WebSocket from origin %q (%s)", r.Header.Get("Origin"), r.RemoteAddr)
+	return false
+}
+
+// corsMiddleware answers preflight requests and marks responses readable by
+// allowed origins. Requests from any other origin are refused outright, as
+// the browser would only hide the response after the handler had run.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	credentials := s.cfg.Server.AllowCredentials
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestOrigin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if requestOrigin != "" {
+			if !s.allowOrigin(r) {
+				log.Printf("Rejected %s %s from origin %q (%s)", r.Method, r.URL.Path, requestOrigin, r.RemoteAddr)
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+
+			h := w.Header()
+			if s.origins.Any() && !credentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				// A credentialed response must name the origin, and caches
+				// must keep one copy per origin.
+				h.Set("Access-Control-Allow-Origin", requestOrigin)
+				h.Add("Vary", "Origin")
+			}
+			if credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			h.Set("Access-Control-Expose-Headers", "X-Cache, X-Next-Cursor")
+
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				h.Set("Access-Control-Max-Age", "600")
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		origin      string
+		preflight   bool
+		status      int
+		allow       string
+	}{
+		{name: "no origin", origins: []string{"https://typemaster.app"}, status: http.StatusOK},
+		{name: "allowed", origins: []string{"https://typemaster.app"}, origin: "https://typemaster.app", status: http.StatusOK, allow: "https://typemaster.app"},
+		{name: "allowed subdomain", origins: []string{"https://*.typemaster.app"}, origin: "https://www.typemaster.app", status: http.StatusOK, allow: "https://www.typemaster.app"},
+		{name: "refused", origins: []string{"https://typemaster.app"}, origin: "https://evil.example", status: http.StatusForbidden},
+		{name: "refused preflight", origins: []string{"https://typemaster.app"}, origin: "https://evil.example", preflight: true, status: http.StatusForbidden},
+		{name: "preflight", origins: []string{"https://typemaster.app"}, origin: "https://typemaster.app", preflight: true, status: http.StatusNoContent, allow: "https://typemaster.app"},
+		{name: "any", origins: []string{"*"}, origin: "https://anywhere.example", status: http.StatusOK, allow: "*"},
+		{name: "credentials", origins: []string{"https://typemaster.app"}, credentials: true, origin: "https://typemaster.app", status: http.StatusOK, allow: "https://typemaster.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Server.AllowedOrigins = tt.origins
+			cfg.Server.AllowCredentials = tt.credentials
+			ts := httptest.NewServer(New(cfg, repository.NewMemoryStores(), nil).RegisterRoutes())
+			t.Cleanup(ts.Close)
+
+			method := http.MethodGet
+			if tt.preflight {
+				method = http.MethodOptions
+			}
+			req, err := http.NewRequest(method, ts.URL+"/health", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Fatalf("Access-Control-Allow-Origin %q, want %q", got, tt.allow)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Credentials") == "true"; got != (tt.credentials && tt.allow != "") {
+				t.Fatalf("Access-Control-Allow-Credentials sent: %v, want %v", got, tt.credentials)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Methods") != ""; got != (tt.preflight && tt.allow != "") {
+				t.Fatalf("preflight headers sent: %v, want %v", got, tt.preflight)
+			}
+		})
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.AllowedOrigins = []string{"https://typemaster.app"}
+	ts := httptest.NewServer(New(cfg, repository.NewMemoryStores(), nil).RegisterRoutes())
+	t.Cleanup(ts.Close)
+	_, token := newGuest(t, ts)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?token=" + token
+
+	tests := []struct {
+		name   string
+		origin string
+		ok     bool
+	}{
+		{name: "allowed", origin: "https://typemaster.app", ok: true},
+		{name: "the backend's own", origin: ts.URL, ok: true},
+		{name: "not a browser", ok: true},
+		{name: "refused", origin: "https://evil.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("upgraded a WebSocket from a refused origin")
+			}
+			if resp == nil || resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("got %v, want status 403", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
+)
+
+// Close codes in the range reserved for applications.
+const (
+	// The client's protocol version is no longer supported. Clients should
+	// not reconnect without reloading.
+	closeUnsupportedVersion = 4000
+	// The client did not open with a valid hello.
+	closeHandshakeFailed = 4001
+)
+
+// handshakeError is a failed handshake and how to close the connection.
+type handshakeError struct {
+	code   int
+	reason string
+}
+
+func (e *handshakeError) Error() string { return e.reason }
+
+// handshake reads the client's hello, which must be its first message, and
+// answers it with welcome. On failure the connection is closed with a code and
+// reason the client can show.
+func handshake(conn *websocket.Conn, wait, writeWait time.Duration) (models.WelcomePayload, error) {
+	welcome, err := readHello(conn, wait)
+	if err != nil {
+		reason := err.Error()
+		code := closeHandshakeFailed
+		var herr *handshakeError
+		if errors.As(err, &herr) {
+			code = herr.code
+		}
+		// Close reasons are limited to 123 bytes.
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		return welcome, err
+	}
+
+	data := encodeEvent(models.EventWelcome, welcome)
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return welcome, err
+	}
+	return welcome, nil
+}
+
+func readHello(conn *websocket.Conn, wait time.Duration) (models.WelcomePayload, error) {
+	conn.SetReadDeadline(time.Now().Add(wait))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		return models.WelcomePayload{}, fmt.Errorf("no hello: %w", err)
+	}
+
+	var event models.WSEvent
+	if err := json.Unmarshal(message, &event); err != nil || event.Type != models.EventHello {
+		return models.WelcomePayload{}, &handshakeError{closeHandshakeFailed, "the first message must be a hello"}
+	}
+	var hello models.HelloPayload
+	if err := json.Unmarshal(event.Payload, &hello); err != nil {
+		return models.WelcomePayload{}, &handshakeError{closeHandshakeFailed, "malformed hello"}
+	}
+
+	welcome, err := protocol.Negotiate(hello)
+	if err != nil {
+		log.Printf("Refused client on protocol version %d", hello.Version)
+		return welcome, &handshakeError{closeUnsupportedVersion, err.Error()}
+	}
+	return welcome, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+func TestHandshake(t *testing.T) {
+	_, ts := newTestServer(t, repository.NewMemoryStores())
+	_, token := newGuest(t, ts)
+
+	// A hello is answered with the version and features agreed on
+	c := dial(t, ts.URL, token)
+	c.send(models.EventHello, models.HelloPayload{Version: protocol.Current + 1, Features: []string{protocol.FeatureErrors, "telepathy"}})
+	var welcome models.WelcomePayload
+	c.expect(models.EventWelcome, &welcome)
+	if welcome.Version != protocol.Current || len(welcome.Features) != 1 || welcome.Features[0] != protocol.FeatureErrors {
+		t.Fatalf("welcome: %+v", welcome)
+	}
+
+	// Errors were agreed on, so a refused event is answered with one
+	c.send(models.EventChatMessage, models.ChatMessagePayload{Message: "hi"})
+	var refused models.ErrorPayload
+	c.expect(models.EventError, &refused)
+	if refused.Code != models.CodeNotInRoom {
+		t.Fatalf("error: %+v", refused)
+	}
+
+	tests := []struct {
+		name   string
+		first  func(c *testConn)
+		code   int
+		reason string
+	}{
+		{
+			name:   "too old",
+			first:  func(c *testConn) { c.send(models.EventHello, models.HelloPayload{Version: protocol.MinSupported - 1}) },
+			code:   closeUnsupportedVersion,
+			reason: "no longer supported",
+		},
+		{
+			name:   "not a hello",
+			first:  func(c *testConn) { c.send(models.EventJoinLobby, models.JoinLobbyPayload{RoomID: "r1"}) },
+			code:   closeHandshakeFailed,
+			reason: "must be a hello",
+		},
+		{
+			name: "malformed hello",
+			first: func(c *testConn) {
+				c.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","payload":{"version":"one"}}`))
+			},
+			code:   closeHandshakeFailed,
+			reason: "malformed hello",
+		},
+		{
+			name:   "not JSON",
+			first:  func(c *testConn) { c.conn.WriteMessage(websocket.TextMessage, []byte("hello")) },
+			code:   closeHandshakeFailed,
+			reason: "must be a hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, ts.URL, token)
+			tt.first(c)
+			c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err := c.conn.ReadMessage()
+			var closed *websocket.CloseError
+			if !errors.As(err, &closed) || closed.Code != tt.code || !strings.Contains(closed.Text, tt.reason) {
+				t.Fatalf("got %v, want close %d mentioning %q", err, tt.code, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// historyFilter reads the /api/history query parameters
+func historyFilter(q url.Values) (models.MatchFilter, error) {
+	f := models.MatchFilter{
+		UserID:   q.Get("user_id"),
+		Mode:     q.Get("mode"),
+		Language: q.Get("language"),
+		Sort:     models.SortNewest,
+		Cursor:   q.Get("cursor"),
+		Limit:    defaultHistoryLimit,
+	}
+	if f.UserID == "" {
+		return f, errors.New("user_id is required")
+	}
+	if !uuidPattern.MatchString(f.UserID) {
+		return f, errors.New("invalid user_id")
+	}
+	if f.Cursor != "" && !uuidPattern.MatchString(f.Cursor) {
+		return f, errors.New("invalid cursor")
+	}
+
+	switch sort := models.MatchSort(q.Get("sort")); sort {
+	case "":
+	case models.SortNewest, models.SortOldest, models.SortFastest:
+		f.Sort = sort
+	default:
+		return f, fmt.Errorf("sort must be one of %s, %s or %s", models.SortNewest, models.SortOldest, models.SortFastest)
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &f.Limit},
+		{"min_duration", &f.MinDuration},
+		{"max_duration", &f.MaxDuration},
+		{"min_wpm", &f.MinWPM},
+		{"max_wpm", &f.MaxWPM},
+	}
+	for _, p := range ints {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("%s must be a non-negative number", p.name)
+		}
+		*p.dst = n
+	}
+	if f.Limit < 1 || f.Limit > maxHistoryLimit {
+		return f, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+	}
+
+	var err error
+	if f.From, err = parseTimeParam(q.Get("from")); err != nil {
+		return f, fmt.Errorf("from: %v", err)
+	}
+	if f.To, err = parseTimeParam(q.Get("to")); err != nil {
+		return f, fmt.Errorf("to: %v", err)
+	}
+	return f, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a plain date, which means
+// midnight UTC.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date or RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// setNextCursor points to the page after matches, unless it was the last one
+func setNextCursor(w http.ResponseWriter, matches []*models.MatchResult, limit int) {
+	if len(matches) == limit && limit > 0 {
+		w.Header().Set("X-Next-Cursor", matches[len(matches)-1].ID)
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
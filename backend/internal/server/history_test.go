@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHistoryCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stores := repository.NewMemoryStores()
+	stores.Cache = repository.NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	s, ts := newTestServer(t, stores)
+
+	user, token := newGuest(t, ts)
+	history := func() ([]*models.MatchResult, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/history?user_id=" + user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("history: status %d", resp.StatusCode)
+		}
+		var matches []*models.MatchResult
+		if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+			t.Fatal(err)
+		}
+		return matches, resp.Header.Get("X-Cache")
+	}
+
+	// A miss reads the store and fills the cache
+	if matches, cache := history(); cache != "MISS" || len(matches) != 0 {
+		t.Fatalf("first read: X-Cache %q with %d matches, want MISS with none", cache, len(matches))
+	}
+	if !mr.Exists("history:" + user.ID) {
+		t.Fatal("a miss did not fill the cache")
+	}
+
+	// A hit is served from the cache
+	if _, cache := history(); cache != "HIT" {
+		t.Fatalf("second read: X-Cache %q, want HIT", cache)
+	}
+
+	// A game_end drops the cached history, so the new match shows up
+	spec := issuedPassage(t, ts, token, 10)
+	identity := auth.Identity{UserID: user.ID, Username: user.Username}
+	// Set as if the test began long enough ago for its keystrokes
+	test := &models.IssuedTest{Passage: spec, Mode: models.TimedMode(30), Language: models.DefaultLanguage, Duration: 30, Start: time.Now().Add(-time.Minute)}
+	if _, err := s.hub.handler.GameEnd(identity, test, gameEnd(spec, 30)); err != nil {
+		t.Fatalf("game_end: %v", err)
+	}
+	if mr.Exists("history:" + user.ID) {
+		t.Fatal("game_end did not invalidate the cached history")
+	}
+	if matches, cache := history(); cache != "MISS" || len(matches) != 1 {
+		t.Fatalf("read after game_end: X-Cache %q with %d matches, want MISS with 1", cache, len(matches))
+	}
+}
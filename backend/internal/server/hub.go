@@ -1,76 +1,438 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"log"
+	"net/http"
+	"time"
 
-	"github.com/nikhilsahni7/typeMaster/backend/internal/database"
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/game"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/handlers"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
 	"github.com/redis/go-redis/v9"
 )
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+// roomMessage is a message addressed to the members of a single room.
+type roomMessage struct {
+	// sender, when set, resolves the target room from the sender's current
+	// membership instead of roomID.
+	sender *Client
+	roomID string
+	data   []byte
+}
+
+// userMessage is a message addressed to every connection of one user.
+type userMessage struct {
+	userID string
+	data   []byte
+}
+
+// clientMessage is a message addressed to a single connection.
+type clientMessage struct {
+	client *Client
+	data   []byte
+}
+
+// membership asks the hub to move a client into a room.
+type membership struct {
+	client *Client
+	roomID string
+}
+
+// registration asks the hub to attach a new connection to a session, resuming
+// the one named by token if it can.
+type registration struct {
+	client  *Client
+	token   string
+	lastSeq uint64
+
+	// Set by the hub before done is closed: the room the client is back
+	// in, if it resumed a session in one.
+	roomID string
+	done   chan struct{}
+}
+
+// Hub maintains the set of active clients and the rooms they belong to, and
+// broadcasts messages to the members of a room. It also holds the session of
+// every client, including recently dropped ones parked in case they resume.
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
+	rooms      map[string]map[*Client]bool
+	memberOf   map[*Client]string
+	sessions   map[string]*session
+	parked     map[string]map[*session]bool // roomID -> parked sessions
+	broadcast  chan *roomMessage
+	direct     chan *userMessage
+	reply      chan *clientMessage
+	register   chan *registration
 	unregister chan *Client
-	redis      *redis.Client
+	join       chan *membership
+	leave      chan *Client
+	relay      *relay
 	handler    *handlers.Handler
+	races      *raceRouter
+
+	limits   config.WebSocket
+	upgrader websocket.Upgrader
 }
 
-func NewHub(db *database.Service, handler *handlers.Handler) *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
+// NewHub creates a hub that shares its rooms with other instances through rdb.
+// With a nil rdb it serves this instance alone. Race state is saved to races
+// so that races survive a restart or the loss of the instance running them.
+func NewHub(rdb *redis.Client, races game.RaceStore, handler *handlers.Handler, limits config.WebSocket, checkOrigin func(r *http.Request) bool) *Hub {
+	h := &Hub{
+		broadcast:  make(chan *roomMessage),
+		direct:     make(chan *userMessage),
+		reply:      make(chan *clientMessage),
+		register:   make(chan *registration),
 		unregister: make(chan *Client),
+		join:       make(chan *membership),
+		leave:      make(chan *Client),
 		clients:    make(map[*Client]bool),
-		redis:      db.Redis,
+		rooms:      make(map[string]map[*Client]bool),
+		memberOf:   make(map[*Client]string),
+		sessions:   make(map[string]*session),
+		parked:     make(map[string]map[*session]bool),
 		handler:    handler,
+		limits:     limits,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  limits.ReadBufferSize,
+			WriteBufferSize: limits.WriteBufferSize,
+			CheckOrigin:     checkOrigin,
+		},
+	}
+	h.races = &raceRouter{local: game.NewManager(h.BroadcastToRoom, races)}
+	if rdb != nil {
+		h.relay = newRelay(rdb)
+		h.races.relay = h.relay
 	}
+	return h
 }
 
 func (h *Hub) Run() {
-	pubsub := h.redis.Subscribe(context.Background(), "global_broadcast")
-	ch := pubsub.Channel()
+	if h.relay != nil {
+		h.relay.start(
+			func(roomID string, data []byte) { h.broadcast <- &roomMessage{roomID: roomID, data: data} },
+			h.races.route,
+			h.races.local.Rooms,
+			h.races.lose,
+			h.races.claim,
+		)
+	}
 
-	go func() {
-		for msg := range ch {
-			h.broadcast <- []byte(msg.Payload)
-		}
-	}()
+	sweep := time.NewTicker(sessionSweepInterval)
+	defer sweep.Stop()
 
 	for {
 		select {
-		case client := <-h.register:
-			h.clients[client] = true
+		case reg := <-h.register:
+			h.attach(reg)
+			close(reg.done)
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.removeClient(client)
 			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+		case m := <-h.join:
+			if _, ok := h.clients[m.client]; ok {
+				h.leaveRoom(m.client)
+				h.joinRoom(m.client, m.roomID)
 			}
+		case client := <-h.leave:
+			if _, ok := h.clients[client]; ok {
+				h.leaveRoom(client)
+				client.session.roomID = ""
+			}
+		case message := <-h.broadcast:
+			h.deliver(message)
+		case message := <-h.direct:
+			h.deliverToUser(message)
+		case message := <-h.reply:
+			h.deliverToClient(message)
+		case now := <-sweep.C:
+			h.expireSessions(now)
 		}
 	}
 }
 
-// PublishToRedis sends a message to all other server instances
-func (h *Hub) PublishToRedis(event models.WSEvent) {
-	data, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Error marshaling event for redis: %v", err)
+// BroadcastToRoom queues a message for every member of roomID, on this
+// instance and any other. It must not be called from the hub's own goroutine.
+func (h *Hub) BroadcastToRoom(roomID string, data []byte) {
+	if h.relay != nil {
+		h.relay.publish(roomID, data)
+	}
+	h.broadcast <- &roomMessage{roomID: roomID, data: data}
+}
+
+// relayFrom queues a message from client for the other members of its room,
+// on this instance and any other.
+func (h *Hub) relayFrom(client *Client, data []byte) {
+	if h.relay != nil && client.roomID != "" {
+		h.relay.publish(client.roomID, data)
+	}
+	h.broadcast <- &roomMessage{sender: client, data: data}
+}
+
+// sendTo queues a message for a single connection, such as an error in reply
+// to one of its events.
+func (h *Hub) sendTo(client *Client, data []byte) {
+	if data != nil {
+		h.reply <- &clientMessage{client: client, data: data}
+	}
+}
+
+// SendToUser queues a message for every connection of userID. It must not be
+// called from the hub's own goroutine.
+func (h *Hub) SendToUser(userID string, data []byte) {
+	h.direct <- &userMessage{userID: userID, data: data}
+}
+
+// attach gives a new connection its session, telling clients that can resume
+// it how to. A client that names a session
+// of its own, parked or still attached to a dying connection, takes it over:
+// it is put back in the session's room and sent the events it missed.
+// Anything else, such as a token from another instance or one that has
+// expired, starts a new session. Sessions are not shared between instances,
+// so deployments with several route each client to one of them; a client
+// whose session was not resumed rejoins its room and gets its race_state.
+func (h *Hub) attach(reg *registration) {
+	client := reg.client
+	h.clients[client] = true
+
+	sess, ok := h.sessions[reg.token]
+	if !ok || sess.userID != client.identity.UserID {
+		sess = newSession(client.identity, h.limits.ReplayBuffer)
+		h.sessions[sess.token] = sess
+		sess.client = client
+		client.session = sess
+		if client.accepts(protocol.FeatureResume) {
+			client.send <- encodeEvent(models.EventSession, models.SessionPayload{Token: sess.token, Complete: true})
+		}
+		return
+	}
+
+	if old := sess.client; old != nil {
+		h.dropClient(old)
+	} else {
+		h.unpark(sess)
+	}
+	sess.client = client
+	client.session = sess
+	if sess.roomID != "" {
+		h.joinRoom(client, sess.roomID)
+	}
+
+	missed, complete := sess.since(reg.lastSeq)
+	client.send <- encodeEvent(models.EventSession, models.SessionPayload{
+		Token:    sess.token,
+		Resumed:  true,
+		RoomID:   sess.roomID,
+		Seq:      sess.seq,
+		Replayed: len(missed),
+		Complete: complete,
+	})
+	for _, event := range missed {
+		client.send <- event
+	}
+	reg.roomID = sess.roomID
+	log.Printf("User %s resumed their session, %d events replayed", sess.userID, len(missed))
+}
+
+// park keeps a dropped client's session, and its place in its room, open for
+// the resume window.
+func (h *Hub) park(sess *session) {
+	sess.client = nil
+	sess.parkedAt = time.Now()
+	if sess.roomID == "" {
 		return
 	}
-	h.redis.Publish(context.Background(), "global_broadcast", data)
+	parked, ok := h.parked[sess.roomID]
+	if !ok {
+		parked = make(map[*session]bool)
+		h.parked[sess.roomID] = parked
+	}
+	parked[sess] = true
+}
+
+func (h *Hub) unpark(sess *session) {
+	if parked, ok := h.parked[sess.roomID]; ok {
+		delete(parked, sess)
+		if len(parked) == 0 {
+			delete(h.parked, sess.roomID)
+		}
+	}
+}
+
+// expireSessions ends the parked sessions whose resume window has passed,
+// taking their users out of their rooms' races.
+func (h *Hub) expireSessions(now time.Time) {
+	for token, sess := range h.sessions {
+		if sess.client != nil || now.Sub(sess.parkedAt) < h.limits.ResumeWindow {
+			continue
+		}
+		delete(h.sessions, token)
+		if sess.roomID == "" {
+			continue
+		}
+		h.unpark(sess)
+		h.closeIfEmpty(sess.roomID)
+		if h.inRoom(sess.userID, sess.roomID) {
+			continue
+		}
+		// Both go through the hub, so they cannot be sent from here.
+		left := encodeEvent(models.EventPlayerLeft, models.PlayerPayload{RoomID: sess.roomID, UserID: sess.userID, Username: sess.username})
+		go func(roomID, userID string) {
+			h.BroadcastToRoom(roomID, left)
+			h.races.Leave(roomID, userID)
+		}(sess.roomID, sess.userID)
+	}
+}
+
+// inRoom reports whether any session of userID here, live or parked, is in
+// roomID.
+func (h *Hub) inRoom(userID, roomID string) bool {
+	for _, sess := range h.sessions {
+		if sess.userID == userID && sess.roomID == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) joinRoom(client *Client, roomID string) {
+	client.session.roomID = roomID
+	room, ok := h.rooms[roomID]
+	if !ok {
+		room = make(map[*Client]bool)
+		h.rooms[roomID] = room
+		if h.relay != nil {
+			h.relay.subscribe(roomID)
+		}
+		log.Printf("Room %s created", roomID)
+	}
+	room[client] = true
+	h.memberOf[client] = roomID
+}
+
+// leaveRoom removes the client from its current room, deleting the room once
+// the last member has left.
+func (h *Hub) leaveRoom(client *Client) {
+	roomID, ok := h.memberOf[client]
+	if !ok {
+		return
+	}
+	delete(h.memberOf, client)
+
+	if room, ok := h.rooms[roomID]; ok {
+		delete(room, client)
+		h.closeIfEmpty(roomID)
+	}
+}
+
+// closeIfEmpty deletes a room once it has neither members nor parked
+// sessions waiting to come back to it.
+func (h *Hub) closeIfEmpty(roomID string) {
+	room, ok := h.rooms[roomID]
+	if !ok || len(room) > 0 || len(h.parked[roomID]) > 0 {
+		return
+	}
+	delete(h.rooms, roomID)
+	if h.relay != nil {
+		h.relay.unsubscribe(roomID)
+	}
+	log.Printf("Room %s closed", roomID)
+}
+
+// removeClient disconnects a client, parking its session so that it can
+// resume.
+func (h *Hub) removeClient(client *Client) {
+	h.park(client.session)
+	h.dropClient(client)
+}
+
+// dropClient disconnects a client without touching its session.
+func (h *Hub) dropClient(client *Client) {
+	h.leaveRoom(client)
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// deliver sends a message to this instance's members of its room. Messages
+// without a sender or room go to every client.
+func (h *Hub) deliver(message *roomMessage) {
+	var targets map[*Client]bool
+	roomID := message.roomID
+	switch {
+	case message.sender != nil:
+		var ok bool
+		if roomID, ok = h.memberOf[message.sender]; !ok {
+			return
+		}
+		targets = h.rooms[roomID]
+	case roomID != "":
+		targets = h.rooms[roomID]
+	default:
+		targets = h.clients
+	}
+
+	// Parked sessions first, so that clients parked below are not sent the
+	// message twice.
+	for sess := range h.parked[roomID] {
+		sess.push(message.data)
+	}
+	for client := range targets {
+		data := client.session.push(message.data)
+		select {
+		case client.send <- data:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+func (h *Hub) deliverToUser(message *userMessage) {
+	for _, sess := range h.sessions {
+		if sess.userID != message.userID {
+			continue
+		}
+		data := sess.push(message.data)
+		if sess.client == nil {
+			continue
+		}
+		select {
+		case sess.client.send <- data:
+		default:
+			h.removeClient(sess.client)
+		}
+	}
+}
+
+func (h *Hub) deliverToClient(message *clientMessage) {
+	client := message.client
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	select {
+	case client.send <- client.session.push(message.data):
+	default:
+		h.removeClient(client)
+	}
+}
+
+// encodeEvent builds an event from the server, logging and returning nil if
+// the payload cannot be encoded.
+func encodeEvent(eventType models.EventType, payload any) []byte {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling %s payload: %v", eventType, err)
+		return nil
+	}
+	msg, err := json.Marshal(models.WSEvent{Type: eventType, Payload: data})
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", eventType, err)
+		return nil
+	}
+	return msg
 }
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+const (
+	defaultLeaderboardLimit = 25
+	maxLeaderboardLimit     = 100
+
+	defaultAroundRadius = 5
+	maxAroundRadius     = 25
+)
+
+// handleGetLeaderboard returns a page of the board for a mode, language and
+// duration, for all time or the current day, week or month. With a session
+// token, the caller's own rank is included.
+func (s *Server) handleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	board, period, err := boardParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := period.Start(time.Now())
+
+	offset, limit, err := pageParams(q.Get("offset"), q.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := s.leaderboards.GetTopPlayers(r.Context(), board, period, start, offset, limit)
+	if err != nil {
+		log.Printf("Error fetching leaderboard: %v", err)
+		http.Error(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	page := models.LeaderboardPage{Board: board, Period: period, Total: total, Offset: offset, Entries: entries}
+	if period != models.AllTime {
+		page.Start = &start
+	}
+
+	if identity, err := s.authenticate(r); err == nil {
+		page.Me, err = s.leaderboards.GetPlayerRank(r.Context(), board, period, start, identity.UserID)
+		if err != nil {
+			log.Printf("Error fetching rank for %s: %v", identity.UserID, err)
+		}
+		if page.Me != nil {
+			page.Me.Username = identity.Username
+		}
+	}
+
+	if err := s.withUsernames(r.Context(), page.Entries); err != nil {
+		log.Printf("Error looking up leaderboard usernames: %v", err)
+		http.Error(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// handleGetLeaderboardAround returns the entries ranked just above and below
+// a user, with that user as Me. The user is given by user_id, or is the
+// caller when it is omitted.
+func (s *Server) handleGetLeaderboardAround(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	board, period, err := boardParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := period.Start(time.Now())
+
+	radius := int64(defaultAroundRadius)
+	if v := q.Get("radius"); v != "" {
+		if radius, err = strconv.ParseInt(v, 10, 64); err != nil || radius < 0 || radius > maxAroundRadius {
+			http.Error(w, fmt.Sprintf("radius must be between 0 and %d", maxAroundRadius), http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID := q.Get("user_id")
+	if userID == "" {
+		identity, err := s.authenticate(r)
+		if err != nil {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+		userID = identity.UserID
+	}
+
+	me, err := s.leaderboards.GetPlayerRank(r.Context(), board, period, start, userID)
+	if err != nil {
+		log.Printf("Error fetching rank for %s: %v", userID, err)
+		http.Error(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	if me == nil {
+		http.Error(w, "user is not on this leaderboard", http.StatusNotFound)
+		return
+	}
+
+	offset := max(0, me.Rank-1-radius)
+	entries, total, err := s.leaderboards.GetTopPlayers(r.Context(), board, period, start, offset, me.Rank-offset+radius)
+	if err != nil {
+		log.Printf("Error fetching leaderboard: %v", err)
+		http.Error(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	if err := s.withUsernames(r.Context(), entries); err != nil {
+		log.Printf("Error looking up leaderboard usernames: %v", err)
+		http.Error(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	page := models.LeaderboardPage{Board: board, Period: period, Total: total, Offset: offset, Entries: entries}
+	if period != models.AllTime {
+		page.Start = &start
+	}
+	for i := range entries {
+		if entries[i].UserID == userID {
+			page.Me = &entries[i]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// handleGetLeaderboardArchive returns the final standings of a board for a
+// finished day, week or month, the most recent one unless start is given.
+func (s *Server) handleGetLeaderboardArchive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	board, period, err := boardParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if period == models.AllTime {
+		http.Error(w, "all_time boards are not archived", http.StatusBadRequest)
+		return
+	}
+
+	var start time.Time
+	if v := q.Get("start"); v != "" {
+		if start, err = time.Parse(time.DateOnly, v); err != nil {
+			http.Error(w, "start must be a date like 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		start = period.Start(start)
+	}
+
+	_, limit, err := pageParams("", q.Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.archive.GetArchive(r.Context(), board, period, start, int(limit))
+	if err != nil {
+		log.Printf("Error fetching leaderboard archive: %v", err)
+		http.Error(w, "failed to fetch leaderboard archive", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// withUsernames fills in the current username of each entry. Boards store
+// only user IDs, so renames show up straight away.
+func (s *Server) withUsernames(ctx context.Context, entries []models.LeaderboardEntry) error {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.UserID
+	}
+
+	names, err := s.users.GetUsernames(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].Username = names[entries[i].UserID]
+	}
+	return nil
+}
+
+func boardParams(q url.Values) (models.Board, models.Period, error) {
+	duration, err := strconv.Atoi(q.Get("duration"))
+	if err != nil {
+		return models.Board{}, "", errors.New("duration must be a number")
+	}
+	board, err := models.NewBoard(q.Get("mode"), q.Get("language"), duration)
+	if err != nil {
+		return models.Board{}, "", err
+	}
+	period, err := models.ParsePeriod(q.Get("period"))
+	if err != nil {
+		return models.Board{}, "", err
+	}
+	return board, period, nil
+}
+
+func pageParams(offsetParam, limitParam string) (offset, limit int64, err error) {
+	limit = defaultLeaderboardLimit
+	if offsetParam != "" {
+		if offset, err = strconv.ParseInt(offsetParam, 10, 64); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+	}
+	if limitParam != "" {
+		if limit, err = strconv.ParseInt(limitParam, 10, 64); err != nil || limit < 1 || limit > maxLeaderboardLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLeaderboardLimit)
+		}
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/migrate"
+	"github.com/nikhilsahni7/typeMaster/backend/migrations"
+)
+
+// migrateOnStart brings the schema up to date, unless automatic migration is
+// off, in which case it only checks that the schema is not newer than the
+// binary.
+func migrateOnStart(db *pgxpool.Pool, cfg config.Migrations) error {
+	m, err := migrate.New(db, migrations.Files)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	if !cfg.Auto {
+		pending, err := m.Check(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			log.Printf("WARNING: %d migrations pending; run `api migrate up`", pending)
+		}
+		return nil
+	}
+
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		log.Printf("Applied migration %03d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	log.Printf("Database schema at version %d", m.Latest())
+	return nil
+}
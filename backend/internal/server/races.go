@@ -0,0 +1,138 @@
+package server
+
+import (
+	"log"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/game"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+)
+
+// raceRouter sends race actions to the instance running the room's race. Each
+// room's race runs on a single owner instance; the others forward their
+// members' actions to it and receive its events over the room channel.
+// Without a relay every race runs locally.
+type raceRouter struct {
+	local *game.Manager
+	relay *relay
+}
+
+func (rr *raceRouter) Join(roomID, userID, username string) {
+	if rr.relay != nil {
+		rr.relay.addMember(roomID, userID, username)
+	}
+	rr.route(raceAction{Type: actionJoin, RoomID: roomID, UserID: userID, Username: username})
+}
+
+// Leave takes a user out of a room's race, unless they are still in the room
+// through another instance.
+func (rr *raceRouter) Leave(roomID, userID string) {
+	if rr.relay != nil {
+		rr.relay.removeMember(roomID, userID)
+		if members, err := rr.relay.roomMembers(roomID); err == nil {
+			if _, ok := members[userID]; ok {
+				return
+			}
+		}
+	}
+	rr.route(raceAction{Type: actionLeave, RoomID: roomID, UserID: userID})
+}
+
+func (rr *raceRouter) Ready(roomID, userID string) {
+	rr.route(raceAction{Type: actionReady, RoomID: roomID, UserID: userID})
+}
+
+func (rr *raceRouter) Progress(roomID, userID string, progress, wpm int) {
+	rr.route(raceAction{Type: actionProgress, RoomID: roomID, UserID: userID, Progress: progress, WPM: wpm})
+}
+
+func (rr *raceRouter) Finish(roomID, userID string, wpm int, accuracy float64, ranked bool) {
+	rr.route(raceAction{Type: actionFinish, RoomID: roomID, UserID: userID, WPM: wpm, Accuracy: accuracy, Unranked: !ranked})
+}
+
+// Test returns the test a user is taking in a room's race, wherever the
+// race runs.
+func (rr *raceRouter) Test(roomID, userID string) (models.IssuedTest, bool) {
+	return rr.local.RaceTest(roomID, userID)
+}
+
+// route applies an action here if this instance owns the room's race, and
+// forwards it to the owner otherwise. Ownership is checked on every action,
+// against the relay's cache of owners, so an instance that has lost a room
+// stops running its race within moments.
+func (rr *raceRouter) route(a raceAction) {
+	if rr.relay == nil {
+		rr.apply(a)
+		return
+	}
+
+	owner, err := rr.relay.owner(a.RoomID)
+	if err != nil {
+		// Keep the race playable on this instance rather than dropping it.
+		log.Printf("Error finding owner of room %s: %v", a.RoomID, err)
+		rr.apply(a)
+		return
+	}
+	if owner != rr.relay.id {
+		rr.lose(a.RoomID)
+		rr.relay.forward(owner, a)
+		return
+	}
+	if rr.local.Race(a.RoomID) == nil {
+		rr.adopt(a.RoomID)
+	}
+	rr.apply(a)
+}
+
+// lose stops this instance's copy of a race now run by another instance.
+func (rr *raceRouter) lose(roomID string) {
+	if rr.local.Discard(roomID) {
+		log.Printf("Instance %s no longer runs the race in room %s", rr.relay.id, roomID)
+	}
+}
+
+// adopt restores the race of a room this instance has just taken over and
+// reconciles it with the members in the room on every instance.
+func (rr *raceRouter) adopt(roomID string) {
+	members, err := rr.relay.roomMembers(roomID)
+	if err != nil {
+		log.Printf("Error loading members of room %s: %v", roomID, err)
+		return
+	}
+	rr.local.Adopt(roomID, members)
+	log.Printf("Instance %s now runs the race in room %s with %d members", rr.relay.id, roomID, len(members))
+}
+
+// claim takes over a room with members on this instance if its owner has
+// gone, so that a race under way keeps running when an instance dies.
+func (rr *raceRouter) claim(roomID string) {
+	if rr.local.Race(roomID) != nil {
+		return
+	}
+	owner, err := rr.relay.owner(roomID)
+	if err != nil {
+		log.Printf("Error finding owner of room %s: %v", roomID, err)
+		return
+	}
+	if owner == rr.relay.id {
+		rr.adopt(roomID)
+	}
+}
+
+// apply runs an action against this instance's races.
+func (rr *raceRouter) apply(a raceAction) {
+	switch a.Type {
+	case actionJoin:
+		rr.local.Join(a.RoomID, a.UserID, a.Username)
+	case actionLeave:
+		rr.local.Leave(a.RoomID, a.UserID)
+		if rr.relay != nil && rr.local.Race(a.RoomID) == nil {
+			rr.relay.release(a.RoomID)
+		}
+	case actionReady:
+		rr.local.Ready(a.RoomID, a.UserID)
+	case actionProgress:
+		rr.local.Progress(a.RoomID, a.UserID, a.Progress, a.WPM)
+	case actionFinish:
+		rr.local.Finish(a.RoomID, a.UserID, a.WPM, a.Accuracy, !a.Unranked)
+	}
+}
@@ -0,0 +1,465 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Room events are published on roomChannel(roomID); race actions for a
+	// room owned elsewhere go to the owner's instanceChannel(id).
+	roomChannelPrefix     = "room:"
+	instanceChannelPrefix = "instance:"
+
+	// How long a room owner or an instance's presence in a room outlives the
+	// last refresh. Refreshes happen every refreshInterval.
+	ownerTTL        = 30 * time.Second
+	presenceTTL     = 30 * time.Second
+	refreshInterval = 10 * time.Second
+
+	// How long a room's owner, once looked up, is trusted without asking
+	// Redis again. An action sent to an instance that no longer owns the
+	// room is passed on from there.
+	ownerCacheTTL = 5 * time.Second
+
+	redisTimeout = 2 * time.Second
+)
+
+func roomChannel(roomID string) string      { return roomChannelPrefix + roomID }
+func instanceChannel(id string) string      { return instanceChannelPrefix + id }
+func roomOwnerKey(roomID string) string     { return "room_owner:" + roomID }
+func roomInstancesKey(roomID string) string { return "room_instances:" + roomID }
+func roomMembersKey(roomID, instance string) string {
+	return "room_members:" + roomID + ":" + instance
+}
+
+// envelope wraps everything sent between instances. Origin lets an instance
+// drop its own messages when they come back from a room channel.
+type envelope struct {
+	Origin string          `json:"origin"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Action *raceAction     `json:"action,omitempty"`
+}
+
+// Race actions forwarded to the instance that owns a room's race.
+const (
+	actionJoin     = "join"
+	actionLeave    = "leave"
+	actionReady    = "ready"
+	actionProgress = "progress"
+	actionFinish   = "finish"
+)
+
+type raceAction struct {
+	Type     string  `json:"type"`
+	RoomID   string  `json:"room_id"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username,omitempty"`
+	Progress int     `json:"progress,omitempty"`
+	WPM      int     `json:"wpm,omitempty"`
+	Accuracy float64 `json:"accuracy,omitempty"`
+	Unranked bool    `json:"unranked,omitempty"`
+}
+
+// claimOwner makes ARGV[1] the room's owner unless another instance already
+// is, returning the owner either way.
+var claimOwner = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner then
+	return owner
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+
+// refreshOwner extends ARGV[1]'s ownership, returning 0 if it has been lost.
+var refreshOwner = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseOwner gives up ARGV[1]'s ownership without touching a newer owner's.
+var releaseOwner = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// relay carries room events and race actions between backend instances over
+// Redis. Each instance subscribes only to the rooms it has members in, plus
+// its own instance channel.
+//
+// Room membership is shared per instance: every instance keeps a hash of its
+// local members for each room and lists itself in the room's instance set.
+// Both expire unless refreshed, so an instance that dies drops out on its own.
+type relay struct {
+	id     string
+	rdb    *redis.Client
+	pubsub *redis.PubSub
+
+	mu      sync.Mutex
+	members map[string]map[string]string // roomID -> userID -> username, on this instance
+
+	// Room subscriptions the hub has asked for, applied in the background so
+	// that Redis round trips never hold up the hub goroutine. Only the latest
+	// request for each room is kept.
+	subMu   sync.Mutex
+	subWant map[string]bool // roomID -> subscribe, or unsubscribe if false
+	subWake chan struct{}
+
+	// Room owners as last seen, so that race actions, progress updates
+	// above all, do not each wait on Redis. This instance's own entries are
+	// renewed by refresh and dropped when it releases or loses the room.
+	ownMu  sync.Mutex
+	owners map[string]cachedOwner
+}
+
+type cachedOwner struct {
+	id    string
+	until time.Time
+}
+
+func newRelay(rdb *redis.Client) *relay {
+	return &relay{
+		id:      newInstanceID(),
+		rdb:     rdb,
+		members: make(map[string]map[string]string),
+		subWant: make(map[string]bool),
+		subWake: make(chan struct{}, 1),
+		owners:  make(map[string]cachedOwner),
+	}
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start subscribes to the instance channel and passes incoming room events to
+// deliver and race actions to apply. owned lists the rooms whose races this
+// instance runs, so their ownership can be kept alive, and lost is called for
+// any of them another instance has taken over; claim is called for every
+// other room with members here, so that orphaned rooms are taken over.
+func (r *relay) start(deliver func(roomID string, data []byte), apply func(raceAction), owned func() []string, lost, claim func(roomID string)) {
+	r.pubsub = r.rdb.Subscribe(context.Background(), instanceChannel(r.id))
+	log.Printf("Relaying rooms over Redis as instance %s", r.id)
+	go r.runSubscriptions()
+
+	go func() {
+		for msg := range r.pubsub.Channel() {
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("Error decoding relayed message on %s: %v", msg.Channel, err)
+				continue
+			}
+			if env.Origin == r.id {
+				continue
+			}
+			switch {
+			case env.Action != nil:
+				apply(*env.Action)
+			case strings.HasPrefix(msg.Channel, roomChannelPrefix):
+				deliver(strings.TrimPrefix(msg.Channel, roomChannelPrefix), env.Data)
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rooms := owned()
+			r.refresh(rooms, lost)
+			r.claimOrphans(rooms, claim)
+		}
+	}()
+}
+
+// subscribe starts receiving a room's events. Called from the hub goroutine
+// when the room gains its first local member; it does not wait for Redis.
+func (r *relay) subscribe(roomID string) {
+	r.queueSubscription(roomID, true)
+}
+
+// unsubscribe stops receiving a room's events once it has no local members.
+func (r *relay) unsubscribe(roomID string) {
+	r.queueSubscription(roomID, false)
+}
+
+func (r *relay) queueSubscription(roomID string, subscribe bool) {
+	r.subMu.Lock()
+	r.subWant[roomID] = subscribe
+	r.subMu.Unlock()
+
+	select {
+	case r.subWake <- struct{}{}:
+	default:
+	}
+}
+
+// runSubscriptions applies queued subscription changes. A room joined and
+// left again before its turn comes costs nothing.
+func (r *relay) runSubscriptions() {
+	subscribed := make(map[string]bool)
+	for range r.subWake {
+		r.subMu.Lock()
+		want := r.subWant
+		r.subWant = make(map[string]bool)
+		r.subMu.Unlock()
+
+		var on, off []string
+		for roomID, subscribe := range want {
+			switch {
+			case subscribe && !subscribed[roomID]:
+				on = append(on, roomChannel(roomID))
+				subscribed[roomID] = true
+			case !subscribe && subscribed[roomID]:
+				off = append(off, roomChannel(roomID))
+				delete(subscribed, roomID)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		if len(on) > 0 {
+			if err := r.pubsub.Subscribe(ctx, on...); err != nil {
+				log.Printf("Error subscribing to %v: %v", on, err)
+			}
+		}
+		if len(off) > 0 {
+			if err := r.pubsub.Unsubscribe(ctx, off...); err != nil {
+				log.Printf("Error unsubscribing from %v: %v", off, err)
+			}
+		}
+		cancel()
+	}
+}
+
+// publish sends a room event to the room's members on other instances.
+func (r *relay) publish(roomID string, data []byte) {
+	r.send(roomChannel(roomID), envelope{Origin: r.id, Data: data})
+}
+
+// forward sends a race action to the instance that owns the room.
+func (r *relay) forward(owner string, action raceAction) {
+	r.send(instanceChannel(owner), envelope{Origin: r.id, Action: &action})
+}
+
+func (r *relay) send(channel string, env envelope) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Error encoding message for %s: %v", channel, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.rdb.Publish(ctx, channel, data).Err(); err != nil {
+		log.Printf("Error publishing to %s: %v", channel, err)
+	}
+}
+
+// owner returns the instance running the room's race, claiming it for this
+// instance if no one is. The answer may be up to ownerCacheTTL old.
+func (r *relay) owner(roomID string) (string, error) {
+	r.ownMu.Lock()
+	cached, ok := r.owners[roomID]
+	r.ownMu.Unlock()
+	if ok && time.Now().Before(cached.until) {
+		return cached.id, nil
+	}
+	return r.claim(roomID)
+}
+
+// claim is owner without the cache.
+func (r *relay) claim(roomID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	owner, err := claimOwner.Run(ctx, r.rdb, []string{roomOwnerKey(roomID)}, r.id, ownerTTL.Milliseconds()).Text()
+	if err != nil {
+		return "", err
+	}
+	r.cacheOwner(roomID, owner)
+	return owner, nil
+}
+
+func (r *relay) cacheOwner(roomID, owner string) {
+	r.ownMu.Lock()
+	defer r.ownMu.Unlock()
+	r.owners[roomID] = cachedOwner{id: owner, until: time.Now().Add(ownerCacheTTL)}
+}
+
+func (r *relay) forgetOwner(roomID string) {
+	r.ownMu.Lock()
+	defer r.ownMu.Unlock()
+	delete(r.owners, roomID)
+}
+
+// release gives up ownership of a room whose race has ended.
+func (r *relay) release(roomID string) {
+	r.forgetOwner(roomID)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := releaseOwner.Run(ctx, r.rdb, []string{roomOwnerKey(roomID)}, r.id).Err(); err != nil {
+		log.Printf("Error releasing room %s: %v", roomID, err)
+	}
+}
+
+// addMember records a local member of a room for other instances to see.
+func (r *relay) addMember(roomID, userID, username string) {
+	r.mu.Lock()
+	room, ok := r.members[roomID]
+	if !ok {
+		room = make(map[string]string)
+		r.members[roomID] = room
+	}
+	room[userID] = username
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, roomMembersKey(roomID, r.id), userID, username)
+		pipe.PExpire(ctx, roomMembersKey(roomID, r.id), presenceTTL)
+		pipe.SAdd(ctx, roomInstancesKey(roomID), r.id)
+		pipe.PExpire(ctx, roomInstancesKey(roomID), presenceTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error adding %s to room %s: %v", userID, roomID, err)
+	}
+}
+
+// removeMember drops a local member, and this instance from the room once it
+// has no members left here.
+func (r *relay) removeMember(roomID, userID string) {
+	r.mu.Lock()
+	room := r.members[roomID]
+	delete(room, userID)
+	empty := len(room) == 0
+	if empty {
+		delete(r.members, roomID)
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, roomMembersKey(roomID, r.id), userID)
+		if empty {
+			pipe.SRem(ctx, roomInstancesKey(roomID), r.id)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error removing %s from room %s: %v", userID, roomID, err)
+	}
+}
+
+// roomMembers returns every member of a room across all live instances,
+// keyed by user ID. Instances whose presence has expired are pruned.
+func (r *relay) roomMembers(roomID string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	instances, err := r.rdb.SMembers(ctx, roomInstancesKey(roomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]string)
+	for _, instance := range instances {
+		local, err := r.rdb.HGetAll(ctx, roomMembersKey(roomID, instance)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(local) == 0 {
+			r.rdb.SRem(ctx, roomInstancesKey(roomID), instance)
+			continue
+		}
+		for userID, username := range local {
+			members[userID] = username
+		}
+	}
+	return members, nil
+}
+
+// claimOrphans calls claim for each room with local members that this
+// instance does not already own.
+func (r *relay) claimOrphans(owned []string, claim func(roomID string)) {
+	skip := make(map[string]bool, len(owned))
+	for _, roomID := range owned {
+		skip[roomID] = true
+	}
+
+	r.mu.Lock()
+	var rooms []string
+	for roomID := range r.members {
+		if !skip[roomID] {
+			rooms = append(rooms, roomID)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, roomID := range rooms {
+		claim(roomID)
+	}
+}
+
+// refresh keeps this instance's presence and room ownership from expiring,
+// calling lost for each owned room whose ownership has passed to another
+// instance.
+func (r *relay) refresh(owned []string, lost func(roomID string)) {
+	r.mu.Lock()
+	members := make(map[string]map[string]string, len(r.members))
+	for roomID, room := range r.members {
+		copied := make(map[string]string, len(room))
+		for userID, username := range room {
+			copied[userID] = username
+		}
+		members[roomID] = copied
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for roomID, room := range members {
+			pipe.HSet(ctx, roomMembersKey(roomID, r.id), room)
+			pipe.PExpire(ctx, roomMembersKey(roomID, r.id), presenceTTL)
+			pipe.SAdd(ctx, roomInstancesKey(roomID), r.id)
+			pipe.PExpire(ctx, roomInstancesKey(roomID), presenceTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error refreshing room presence: %v", err)
+	}
+
+	for _, roomID := range owned {
+		ok, err := refreshOwner.Run(ctx, r.rdb, []string{roomOwnerKey(roomID)}, r.id, ownerTTL.Milliseconds()).Int()
+		switch {
+		case err != nil:
+			log.Printf("Error refreshing ownership of room %s: %v", roomID, err)
+		case ok != 0:
+			r.cacheOwner(roomID, r.id)
+		default:
+			// Claim it back if it only expired and no one else has taken it
+			if owner, err := r.claim(roomID); err == nil && owner == r.id {
+				continue
+			}
+			log.Printf("Lost ownership of room %s to another instance", roomID)
+			lost(roomID)
+		}
+	}
+}
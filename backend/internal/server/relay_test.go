@@ -0,0 +1,202 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRelays returns n relays that share one Redis, as instances would
+func newRelays(t *testing.T, n int) (*miniredis.Miniredis, []*relay) {
+	mr := miniredis.RunT(t)
+	relays := make([]*relay, n)
+	for i := range relays {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		relays[i] = newRelay(rdb)
+	}
+	return mr, relays
+}
+
+func TestRelayOwner(t *testing.T) {
+	const roomID = "room"
+	mr, relays := newRelays(t, 2)
+	a, b := relays[0], relays[1]
+
+	owner := func(r *relay) string {
+		t.Helper()
+		id, err := r.owner(roomID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// The first to ask claims the room
+	if got := owner(a); got != a.id {
+		t.Fatalf("first claim went to %s, want %s", got, a.id)
+	}
+	if got := owner(b); got != a.id {
+		t.Fatalf("b sees owner %s, want %s", got, a.id)
+	}
+
+	// Once looked up, the owner is not asked for again until the cache
+	// expires, even if it has changed in the meantime
+	a.release(roomID)
+	if mr.Exists(roomOwnerKey(roomID)) {
+		t.Fatal("release left the owner key")
+	}
+	if got := owner(b); got != a.id {
+		t.Fatalf("b sees owner %s, want the cached %s", got, a.id)
+	}
+	b.ownMu.Lock()
+	cached := b.owners[roomID]
+	cached.until = time.Now()
+	b.owners[roomID] = cached
+	b.ownMu.Unlock()
+	if got := owner(b); got != b.id {
+		t.Fatalf("after the cache expired b sees owner %s, want itself", got)
+	}
+
+	// A release by an instance that no longer owns the room leaves it be
+	a.release(roomID)
+	if got, _ := mr.Get(roomOwnerKey(roomID)); got != b.id {
+		t.Fatalf("owner %q after a stale release, want %s", got, b.id)
+	}
+}
+
+func TestRelayRefresh(t *testing.T) {
+	const roomID = "room"
+	mr, relays := newRelays(t, 2)
+	a, b := relays[0], relays[1]
+	var lost []string
+	onLost := func(roomID string) { lost = append(lost, roomID) }
+
+	if _, err := a.owner(roomID); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(ownerTTL - time.Second)
+	a.refresh([]string{roomID}, onLost)
+	if ttl := mr.TTL(roomOwnerKey(roomID)); ttl != ownerTTL {
+		t.Fatalf("owner key expires in %s after a refresh, want %s", ttl, ownerTTL)
+	}
+
+	// Ownership that merely expired is claimed back
+	mr.FastForward(ownerTTL)
+	a.refresh([]string{roomID}, onLost)
+	if got, _ := mr.Get(roomOwnerKey(roomID)); got != a.id || len(lost) != 0 {
+		t.Fatalf("owner %q, lost %v; want a to claim the room back", got, lost)
+	}
+
+	// Ownership taken by another instance is lost, and forgotten
+	mr.Del(roomOwnerKey(roomID))
+	if _, err := b.owner(roomID); err != nil {
+		t.Fatal(err)
+	}
+	a.refresh([]string{roomID}, onLost)
+	if len(lost) != 1 || lost[0] != roomID {
+		t.Fatalf("lost %v, want %s", lost, roomID)
+	}
+	if got, _ := a.owner(roomID); got != b.id {
+		t.Fatalf("a sees owner %s, want %s", got, b.id)
+	}
+}
+
+func TestRelayMembers(t *testing.T) {
+	const roomID = "room"
+	mr, relays := newRelays(t, 2)
+	a, b := relays[0], relays[1]
+
+	a.addMember(roomID, "u1", "One")
+	a.addMember(roomID, "u2", "Two")
+	b.addMember(roomID, "u3", "Three")
+	members, err := a.roomMembers(roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 || members["u3"] != "Three" {
+		t.Fatalf("members %v, want all three", members)
+	}
+
+	// An instance with no members left drops out of the room
+	b.removeMember(roomID, "u3")
+	if ok, _ := mr.IsMember(roomInstancesKey(roomID), b.id); ok {
+		t.Fatal("b is still listed in the room with no members")
+	}
+	a.removeMember(roomID, "u1")
+	if ok, _ := mr.IsMember(roomInstancesKey(roomID), a.id); !ok {
+		t.Fatal("a dropped out of the room with a member left")
+	}
+
+	// An instance whose presence expired is pruned from the room
+	b.addMember(roomID, "u3", "Three")
+	mr.Del(roomMembersKey(roomID, a.id))
+	members, err = b.roomMembers(roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members["u3"] != "Three" {
+		t.Fatalf("members %v, want only b's", members)
+	}
+	if ok, _ := mr.IsMember(roomInstancesKey(roomID), a.id); ok {
+		t.Fatal("a is still listed in the room after its presence expired")
+	}
+}
+
+func TestRelayDelivery(t *testing.T) {
+	const roomID = "room"
+	mr, relays := newRelays(t, 2)
+	a, b := relays[0], relays[1]
+
+	delivered := make(chan string, 4)
+	applied := make(chan raceAction, 4)
+	for _, r := range relays {
+		r.start(
+			func(roomID string, data []byte) { delivered <- string(data) },
+			func(action raceAction) { applied <- action },
+			func() []string { return nil },
+			func(string) {},
+			func(string) {},
+		)
+		t.Cleanup(func() { r.pubsub.Close() })
+	}
+
+	a.subscribe(roomID)
+	b.subscribe(roomID)
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub(roomChannel(roomID))[roomChannel(roomID)] < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("relays did not subscribe to the room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Room events reach other instances, but do not come back to the sender
+	a.publish(roomID, []byte(`{"type":"chat"}`))
+	select {
+	case data := <-delivered:
+		if data != `{"type":"chat"}` {
+			t.Fatalf("delivered %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("room event not delivered")
+	}
+	select {
+	case data := <-delivered:
+		t.Fatalf("delivered %s twice", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Race actions reach the instance they are forwarded to
+	b.forward(a.id, raceAction{Type: actionReady, RoomID: roomID, UserID: "u1"})
+	select {
+	case action := <-applied:
+		if action.Type != actionReady || action.UserID != "u1" {
+			t.Fatalf("applied %+v", action)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("race action not applied")
+	}
+}
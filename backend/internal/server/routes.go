@@ -9,15 +9,38 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/health", s.HealthHandler)
-	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		ServeWs(s.hub, w, r)
-	})
+	mux.HandleFunc("/ws", s.handleWs)
 
 	mux.HandleFunc("/api/history", s.handleGetHistory)
+	mux.HandleFunc("/api/stats", s.handleGetStats)
+	mux.HandleFunc("/api/analytics/keys", s.handleGetKeyAnalytics)
+	mux.HandleFunc("/api/achievements", s.handleGetAchievements)
+	mux.HandleFunc("/api/passage", s.handleGetPassage)
+	mux.HandleFunc("/api/practice", s.handleGetPractice)
+	mux.HandleFunc("/api/leaderboard", s.handleGetLeaderboard)
+	mux.HandleFunc("/api/leaderboard/around", s.handleGetLeaderboardAround)
+	mux.HandleFunc("/api/leaderboard/archive", s.handleGetLeaderboardArchive)
+
+	mux.HandleFunc("/api/auth/register", s.handleRegister)
+	mux.HandleFunc("/api/auth/login", s.handleLogin)
+	mux.HandleFunc("/api/auth/guest", s.handleGuest)
+	mux.HandleFunc("/api/auth/logout", s.handleLogout)
+	mux.HandleFunc("/api/auth/me", s.handleMe)
 
 	return s.corsMiddleware(mux)
 }
 
+// handleWs upgrades an authenticated request to a WebSocket bound to the
+// session's user.
+func (s *Server) handleWs(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.authenticate(r)
+	if err != nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	ServeWs(s.hub, identity, w, r)
+}
+
 func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	health := map[string]string{
 		"status":  "healthy",
@@ -48,18 +71,3 @@ func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(jsonResp)
 }
-
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
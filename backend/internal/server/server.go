@@ -2,71 +2,314 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/achievements"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/database"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/handlers"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/origin"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/practice"
 	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+	"github.com/redis/go-redis/v9"
 )
 
+// How long an issued passage can still be typed for a result
+const issuedPassageTTL = time.Hour
+
 type Server struct {
-	port      int
-	db        *database.Service
-	hub       *Hub
-	matchRepo *repository.MatchRepository
-}
+	cfg *config.Config
+	db  *database.Service // Nil when running on in-memory stores
+	hub *Hub
 
-func NewServer() *http.Server {
-	port := 8080
+	origins *origin.Policy
 
-	db, err := database.New()
+	matches      repository.MatchStore
+	users        repository.UserStore
+	leaderboards repository.LeaderboardStore
+	archive      repository.LeaderboardArchive
+	cache        repository.ResultCache
+	passages     repository.PassageStore
+	sessions     *auth.Sessions
+
+	practice     *practice.Service
+	achievements *achievements.Service
+}
+
+func NewServer(cfg *config.Config) *http.Server {
+	db, err := database.New(cfg)
 	if err != nil {
 		log.Fatalf("cannot connect to database: %v\n", err)
 	}
-
-	matchRepo := repository.NewMatchRepository(db.DB)
-	userRepo := repository.NewUserRepository(db.DB)
-	redisCache := repository.NewRedisCache(db.Redis)
-	handler := handlers.NewHandler(matchRepo, userRepo, redisCache)
-
-	hub := NewHub(db, handler)
-	go hub.Run()
-
-	s := &Server{
-		port:      port,
-		db:        db,
-		hub:       hub,
-		matchRepo: matchRepo,
+	if err := migrateOnStart(db.DB, cfg.Migrations); err != nil {
+		log.Fatalf("cannot start: %v", err)
 	}
 
+	s := New(cfg, repository.NewStores(db.DB, db.Redis), db.Redis)
+	s.db = db
+
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.port),
+		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:      s.RegisterRoutes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
 	return server
 }
 
+// New builds a Server on the given stores and starts the hub and the
+// leaderboard archiver. rdb relays messages between server instances and may
+// be nil when there is only one.
+func New(cfg *config.Config, stores repository.Stores, rdb *redis.Client) *Server {
+	origins, err := origin.NewPolicy(cfg.Server.AllowedOrigins)
+	if err != nil {
+		log.Fatalf("invalid allowed origins: %v", err)
+	}
+	if origins.Any() {
+		log.Println("WARNING: every origin may call the API and open WebSockets")
+	}
+
+	achievementService := achievements.NewService(stores.Matches, stores.Achievements)
+	handler := handlers.NewHandler(stores, achievementService)
+
+	s := &Server{
+		cfg:          cfg,
+		origins:      origins,
+		matches:      stores.Matches,
+		users:        stores.Users,
+		leaderboards: stores.Leaderboards,
+		archive:      stores.Archive,
+		cache:        stores.Cache,
+		passages:     stores.Passages,
+		sessions:     auth.NewSessions(stores.Sessions, cfg.Session),
+		practice:     practice.NewService(stores.Matches),
+		achievements: achievementService,
+	}
+
+	s.hub = NewHub(rdb, stores.Races, handler, cfg.WebSocket, s.checkOrigin)
+	handler.Notify = s.hub.SendToUser
+	go s.hub.Run()
+	go s.runLeaderboardArchiver()
+	return s
+}
+
+// handleGetHistory returns a page of a user's matches. Pass the
+// X-Next-Cursor header of a response as cursor to get the page after it; a
+// cursor that is not one of the user's matches is refused. The default first
+// page is read through the Redis cache, and the X-Cache header says whether
+// the cache was hit.
 func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+	filter, err := historyFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.IsDefault() && filter.Limit == defaultHistoryLimit {
+		s.serveCachedHistory(w, r, filter)
 		return
 	}
 
-	matches, err := s.matchRepo.GetMatchesByUserID(r.Context(), userID, 50)
+	matches, err := s.matches.ListMatches(r.Context(), filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
+		log.Printf("Error fetching history for %s: %v", filter.UserID, err)
 		http.Error(w, "failed to fetch history", http.StatusInternalServerError)
 		return
 	}
+	if matches == nil {
+		matches = []*models.MatchResult{}
+	}
 
+	setNextCursor(w, matches, filter.Limit)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(matches)
 }
+
+func (s *Server) serveCachedHistory(w http.ResponseWriter, r *http.Request, filter models.MatchFilter) {
+	userID := filter.UserID
+
+	cached, err := s.cache.GetCachedMatchHistory(r.Context(), userID)
+	if err == nil {
+		var matches []*models.MatchResult
+		if json.Unmarshal([]byte(cached), &matches) == nil {
+			setNextCursor(w, matches, filter.Limit)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		w.Write([]byte(cached))
+		return
+	}
+	if err != repository.ErrCacheMiss {
+		log.Printf("Error reading cached history for %s: %v", userID, err)
+	}
+
+	matches, err := s.matches.ListMatches(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+	if matches == nil {
+		matches = []*models.MatchResult{}
+	}
+
+	data, err := json.Marshal(matches)
+	if err != nil {
+		http.Error(w, "failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.CacheMatchHistory(r.Context(), userID, data); err != nil {
+		log.Printf("Error caching history for %s: %v", userID, err)
+	}
+
+	setNextCursor(w, matches, filter.Limit)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(data)
+}
+
+// handleGetPassage generates a passage, sized by words or by the duration of
+// a timed test. Passing the seed from an earlier response (or from
+// game_start) returns exactly the same text. A fresh passage fetched with a
+// session is the one the caller's next solo result must be typed on.
+func (s *Server) handleGetPassage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	difficulty, err := passage.ParseDifficulty(q.Get("difficulty"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	words, seconds, err := passageWords(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	spec := passage.NewSpec(difficulty, words)
+	if v := q.Get("seed"); v != "" {
+		if spec.Seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "seed must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A fresh passage is what a signed-in player's next solo result is
+	// checked against.
+	if identity, err := s.authenticate(r); err == nil && q.Get("seed") == "" {
+		test := models.IssuedTest{Passage: spec, Mode: models.ModeWords, Language: models.DefaultLanguage, Duration: seconds, Start: time.Now()}
+		if seconds > 0 {
+			test.Mode = models.TimedMode(seconds)
+		}
+		if !s.issuePassage(w, r, identity.UserID, test) {
+			return
+		}
+	}
+
+	resp := struct {
+		passage.Spec
+		Text string `json:"text"`
+	}{spec, spec.Text()}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleGetPractice generates a drill passage weighted toward the caller's
+// weak keys. Results typed on it are recorded in the practice mode.
+func (s *Server) handleGetPractice(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.authenticate(r)
+	if err != nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	difficulty, err := passage.ParseDifficulty(q.Get("difficulty"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	words, seconds, err := passageWords(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	spec, err := s.practice.NewSpec(r.Context(), identity.UserID, difficulty, words)
+	if err != nil {
+		log.Printf("Error building practice passage for %s: %v", identity.UserID, err)
+		http.Error(w, "failed to build practice passage", http.StatusInternalServerError)
+		return
+	}
+	if err := spec.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	test := models.IssuedTest{Passage: spec, Mode: models.ModePractice, Language: models.DefaultLanguage, Duration: seconds, Start: time.Now()}
+	if !s.issuePassage(w, r, identity.UserID, test) {
+		return
+	}
+
+	resp := struct {
+		passage.Spec
+		Text string `json:"text"`
+		Mode string `json:"mode"`
+	}{spec, spec.Text(), models.ModePractice}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// passageWords reads how long a passage should be: words, or for a timed
+// test of duration seconds, enough words that even the fastest typist cannot
+// run out. It also returns the duration, 0 for an untimed test.
+func passageWords(q url.Values) (words, seconds int, err error) {
+	words = passage.DefaultWords
+	if v := q.Get("words"); v != "" {
+		if words, err = strconv.Atoi(v); err != nil {
+			return 0, 0, errors.New("words must be a number")
+		}
+	}
+	if v := q.Get("duration"); v != "" {
+		seconds, err = strconv.Atoi(v)
+		if err != nil || seconds < 1 {
+			return 0, 0, errors.New("duration must be a positive number of seconds")
+		}
+		words = max(words, passage.WordsFor(seconds, anticheat.MaxHumanWPM))
+	}
+	return words, seconds, nil
+}
+
+// issuePassage records the test a user was set, so that their next solo
+// result can be checked against it. It reports whether it succeeded, having
+// answered the request if not.
+func (s *Server) issuePassage(w http.ResponseWriter, r *http.Request, userID string, test models.IssuedTest) bool {
+	if err := s.passages.IssuePassage(r.Context(), userID, test, issuedPassageTTL); err != nil {
+		log.Printf("Error issuing passage to %s: %v", userID, err)
+		http.Error(w, "failed to issue passage", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
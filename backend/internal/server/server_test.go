@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/anticheat"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/passage"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// newTestServer serves the API on stores over a local listener
+func newTestServer(t *testing.T, stores repository.Stores) (*Server, *httptest.Server) {
+	t.Helper()
+	s := New(config.Default(), stores, nil)
+	ts := httptest.NewServer(s.RegisterRoutes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// newGuest signs up a guest and returns it with its session token
+func newGuest(t *testing.T, ts *httptest.Server) (*models.User, string) {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/api/auth/guest", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("guest sign-up: status %d", resp.StatusCode)
+	}
+
+	var session sessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	return session.User, session.Token
+}
+
+// issuedPassage fetches a passage of the given length as the holder of token,
+// so that it is the one the next solo result is checked against.
+func issuedPassage(t *testing.T, ts *httptest.Server, token string, words int) passage.Spec {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/passage?words="+strconv.Itoa(words), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("passage: status %d", resp.StatusCode)
+	}
+
+	var spec passage.Spec
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// gameEnd builds the game_end of a clean timed test of the given length on
+// spec, typed at about 60 WPM with the uneven rhythm of a person typing.
+func gameEnd(spec passage.Spec, seconds int) *models.GameEndPayload {
+	limit := int64(seconds) * 1000
+	var keys []anticheat.Keystroke
+	var at int64
+	for i, r := range []rune(spec.Text()) {
+		if at > limit {
+			break
+		}
+		keys = append(keys, anticheat.Keystroke{Key: string(r), Time: at})
+		at += 180 + int64(i%5)*10
+	}
+
+	stats, err := anticheat.Replay(spec.Text(), keys, time.Duration(seconds)*time.Second)
+	if err != nil {
+		panic(err)
+	}
+	return &models.GameEndPayload{
+		WPM:        stats.WPM,
+		RawWPM:     stats.RawWPM,
+		Accuracy:   stats.Accuracy,
+		Mode:       "time_" + strconv.Itoa(seconds),
+		Language:   "english",
+		Duration:   seconds,
+		Passage:    &spec,
+		Keystrokes: keys,
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+)
+
+// How often the hub looks for parked sessions whose resume window has passed.
+const sessionSweepInterval = 5 * time.Second
+
+// session is what a client keeps across reconnects: its room and the recent
+// events sent to it, numbered so that a client coming back can be sent the
+// ones it missed. When its connection drops, a session is parked; it keeps
+// its room and race place and goes on buffering room events until the client
+// resumes it or the resume window passes.
+//
+// Sessions belong to the hub goroutine.
+type session struct {
+	token    string
+	userID   string
+	username string
+	client   *Client // nil while parked
+	roomID   string
+
+	seq      uint64
+	buffer   [][]byte // Recent events, buffer[i] numbered first+i
+	first    uint64
+	max      int
+	parkedAt time.Time
+}
+
+func newSession(identity auth.Identity, max int) *session {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return &session{
+		token:    hex.EncodeToString(b),
+		userID:   identity.UserID,
+		username: identity.Username,
+		first:    1,
+		max:      max,
+	}
+}
+
+// push numbers an event and keeps it for replay, returning it as sent.
+func (s *session) push(data []byte) []byte {
+	s.seq++
+	framed := withSeq(data, s.seq)
+
+	s.buffer = append(s.buffer, framed)
+	if len(s.buffer) > s.max {
+		drop := len(s.buffer) - s.max
+		s.buffer = append(s.buffer[:0:0], s.buffer[drop:]...)
+		s.first += uint64(drop)
+	}
+	return framed
+}
+
+// since returns the kept events after lastSeq. complete is false if some of
+// them have already been dropped.
+func (s *session) since(lastSeq uint64) (events [][]byte, complete bool) {
+	if lastSeq >= s.seq {
+		return nil, true
+	}
+	if lastSeq+1 < s.first {
+		return s.buffer, false
+	}
+	return s.buffer[lastSeq+1-s.first:], true
+}
+
+// withSeq adds a seq field to an encoded event. Events are built by the
+// server as JSON objects, so the field can be spliced in without decoding
+// the event for every recipient.
+func withSeq(data []byte, seq uint64) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	var b bytes.Buffer
+	b.Grow(len(data) + 24)
+	b.WriteString(`{"seq":`)
+	b.WriteString(strconv.FormatUint(seq, 10))
+	if !bytes.Equal(bytes.TrimSpace(data[1:]), []byte("}")) {
+		b.WriteByte(',')
+	}
+	b.Write(data[1:])
+	return b.Bytes()
+}
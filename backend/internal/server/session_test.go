@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/auth"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/config"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/models"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/protocol"
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+func TestWithSeq(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{`{"type":"chat","payload":{}}`, `{"seq":7,"type":"chat","payload":{}}`},
+		{`{}`, `{"seq":7}`},
+		{`{ }`, `{"seq":7 }`},
+		{`[1]`, `[1]`},
+		{``, ``},
+	}
+	for _, tt := range tests {
+		if got := string(withSeq([]byte(tt.data), 7)); got != tt.want {
+			t.Errorf("withSeq(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestSessionSince(t *testing.T) {
+	sess := newSession(auth.Identity{UserID: "u"}, 3)
+	if events, complete := sess.since(0); len(events) != 0 || !complete {
+		t.Fatalf("before any event: %d events, complete %v", len(events), complete)
+	}
+	for i := 1; i <= 5; i++ {
+		sess.push([]byte(fmt.Sprintf(`{"n":%d}`, i)))
+	}
+
+	tests := []struct {
+		lastSeq  uint64
+		seqs     []uint64
+		complete bool
+	}{
+		{lastSeq: 5, complete: true},
+		{lastSeq: 9, complete: true}, // From a session the client mixed up
+		{lastSeq: 4, seqs: []uint64{5}, complete: true},
+		{lastSeq: 2, seqs: []uint64{3, 4, 5}, complete: true},
+		{lastSeq: 1, seqs: []uint64{3, 4, 5}, complete: false}, // 2 was dropped
+		{lastSeq: 0, seqs: []uint64{3, 4, 5}, complete: false},
+	}
+	for _, tt := range tests {
+		events, complete := sess.since(tt.lastSeq)
+		var seqs []uint64
+		for _, data := range events {
+			var event models.WSEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, event.Seq)
+		}
+		if fmt.Sprint(seqs) != fmt.Sprint(tt.seqs) || complete != tt.complete {
+			t.Errorf("since(%d) = %v, complete %v; want %v, complete %v", tt.lastSeq, seqs, complete, tt.seqs, tt.complete)
+		}
+	}
+}
+
+// dialResume reconnects as the holder of token, asking to resume session
+// after lastSeq.
+func dialResume(t *testing.T, url, token, session string, lastSeq uint64) *testConn {
+	t.Helper()
+	query := fmt.Sprintf("/ws?token=%s&resume=%s&last_seq=%d", token, session, lastSeq)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn}
+}
+
+// greet sends a hello that asks to resume and returns the session event
+func (c *testConn) greet() models.SessionPayload {
+	c.t.Helper()
+	c.send(models.EventHello, models.HelloPayload{Version: protocol.Current, Features: []string{protocol.FeatureResume}})
+	var welcome models.WelcomePayload
+	var session models.SessionPayload
+	c.expect(models.EventWelcome, &welcome)
+	c.expect(models.EventSession, &session)
+	return session
+}
+
+// next reads the next event, whatever its type
+func (c *testConn) next() models.WSEvent {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var event models.WSEvent
+	if err := c.conn.ReadJSON(&event); err != nil {
+		c.t.Fatal(err)
+	}
+	return event
+}
+
+// until reads events up to and including the first of eventType, returning
+// the seq of the last one.
+func (c *testConn) until(eventType models.EventType) uint64 {
+	c.t.Helper()
+	for {
+		if event := c.next(); event.Type == eventType {
+			return event.Seq
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	const roomID = "resume_room"
+	cfg := config.Default()
+	cfg.WebSocket.ReplayBuffer = 4
+	ts := httptest.NewServer(New(cfg, repository.NewMemoryStores(), nil).RegisterRoutes())
+	t.Cleanup(ts.Close)
+
+	_, tokenA := newGuest(t, ts)
+	_, tokenB := newGuest(t, ts)
+	a := dial(t, ts.URL, tokenA)
+	session := a.greet()
+	a.send(models.EventJoinLobby, models.JoinLobbyPayload{RoomID: roomID})
+	a.until(models.EventPlayerJoined)
+
+	b := dial(t, ts.URL, tokenB)
+	b.greet()
+	b.send(models.EventJoinLobby, models.JoinLobbyPayload{RoomID: roomID})
+	b.until(models.EventPlayerJoined)
+	lastSeq := a.until(models.EventPlayerJoined)
+
+	// Events sent while a is away are kept for it
+	a.conn.Close()
+	chat := func(message string) {
+		b.send(models.EventChatMessage, models.ChatMessagePayload{Message: message})
+		b.until(models.EventChat)
+	}
+	chat("one")
+	chat("two")
+
+	// Coming back, a is sent what it missed
+	a = dialResume(t, ts.URL, tokenA, session.Token, lastSeq)
+	resumed := a.greet()
+	if !resumed.Resumed || resumed.Token != session.Token || resumed.RoomID != roomID || !resumed.Complete {
+		t.Fatalf("session: %+v", resumed)
+	}
+	if resumed.Seq < lastSeq+2 || resumed.Replayed != int(resumed.Seq-lastSeq) {
+		t.Fatalf("session: %+v, want the events after %d replayed", resumed, lastSeq)
+	}
+
+	var messages []string
+	for seq := lastSeq + 1; seq <= resumed.Seq; seq++ {
+		event := a.next()
+		if event.Seq != seq {
+			t.Fatalf("replayed seq %d, want %d", event.Seq, seq)
+		}
+		if event.Type == models.EventChat {
+			var chat models.ChatPayload
+			json.Unmarshal(event.Payload, &chat)
+			messages = append(messages, chat.Message)
+		}
+	}
+	if strings.Join(messages, " ") != "one two" {
+		t.Fatalf("replayed chat %q, want one and two", messages)
+	}
+
+	// Back in the room, it gets new events numbered on from there
+	chat("three")
+	if seq := a.until(models.EventChat); seq <= resumed.Seq {
+		t.Fatalf("chat after resuming has seq %d, want more than %d", seq, resumed.Seq)
+	}
+	a.conn.Close()
+
+	// Coming back too far behind, it is told some events were dropped
+	for _, message := range []string{"four", "five", "six", "seven", "eight"} {
+		chat(message)
+	}
+	a = dialResume(t, ts.URL, tokenA, session.Token, lastSeq)
+	resumed = a.greet()
+	if !resumed.Resumed || resumed.Complete || resumed.Replayed != cfg.WebSocket.ReplayBuffer {
+		t.Fatalf("session: %+v, want the last %d events and incomplete", resumed, cfg.WebSocket.ReplayBuffer)
+	}
+
+	// Someone else's session token gets a new session
+	other := dialResume(t, ts.URL, tokenB, session.Token, 0)
+	if fresh := other.greet(); fresh.Resumed || fresh.Token == session.Token {
+		t.Fatalf("session: %+v, want a new one", fresh)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/nikhilsahni7/typeMaster/backend/internal/repository"
+)
+
+// Days of daily averages included in a stats response.
+const statsTrendDays = 30
+
+// handleGetStats returns a user's aggregated stats, read through the Redis
+// cache. The X-Cache header says whether the cache was hit.
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if !uuidPattern.MatchString(userID) {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	cached, err := s.cache.GetCachedUserStats(r.Context(), userID)
+	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "HIT")
+		w.Write([]byte(cached))
+		return
+	}
+	if err != repository.ErrCacheMiss {
+		log.Printf("Error reading cached stats for %s: %v", userID, err)
+	}
+
+	stats, err := s.matches.GetUserStats(r.Context(), userID, statsTrendDays, false)
+	if err != nil {
+		log.Printf("Error computing stats for %s: %v", userID, err)
+		http.Error(w, "failed to fetch stats", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, "failed to fetch stats", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.CacheUserStats(r.Context(), userID, data); err != nil {
+		log.Printf("Error caching stats for %s: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", "MISS")
+	w.Write(data)
+}
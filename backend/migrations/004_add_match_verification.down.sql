@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_matches_verification;
+ALTER TABLE matches DROP COLUMN IF EXISTS flag_reasons;
+ALTER TABLE matches DROP COLUMN IF EXISTS verification;
@@ -0,0 +1,4 @@
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS verification VARCHAR(20) NOT NULL DEFAULT 'unverified';
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS flag_reasons TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_matches_verification ON matches(verification) WHERE verification <> 'verified';
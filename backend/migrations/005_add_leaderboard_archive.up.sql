@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS leaderboard_archive (
+    period VARCHAR(20) NOT NULL, -- 'daily', 'weekly' or 'monthly'
+    period_start DATE NOT NULL,
+    mode VARCHAR(50) NOT NULL,
+    language VARCHAR(50) NOT NULL,
+    duration_seconds INTEGER NOT NULL,
+    rank INTEGER NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    wpm INTEGER NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (period, period_start, mode, language, duration_seconds, rank)
+);
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_archive_user_id ON leaderboard_archive(user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE leaderboard_archive DROP COLUMN IF EXISTS achieved_at;
+ALTER TABLE leaderboard_archive DROP COLUMN IF EXISTS match_id;
@@ -0,0 +1,2 @@
+ALTER TABLE leaderboard_archive ADD COLUMN IF NOT EXISTS match_id UUID REFERENCES matches(id) ON DELETE SET NULL;
+ALTER TABLE leaderboard_archive ADD COLUMN IF NOT EXISTS achieved_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_matches_user_mode_created;
+DROP INDEX IF EXISTS idx_matches_user_wpm;
+DROP INDEX IF EXISTS idx_matches_user_created;
@@ -0,0 +1,4 @@
+-- Keyset pagination over a user's history, newest/oldest and fastest first.
+CREATE INDEX IF NOT EXISTS idx_matches_user_created ON matches(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_matches_user_wpm ON matches(user_id, wpm DESC, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_matches_user_mode_created ON matches(user_id, mode, created_at DESC, id DESC);
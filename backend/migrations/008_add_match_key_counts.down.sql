@@ -0,0 +1,3 @@
+ALTER TABLE matches DROP COLUMN IF EXISTS bad_bigrams;
+ALTER TABLE matches DROP COLUMN IF EXISTS bigram_counts;
+ALTER TABLE matches DROP COLUMN IF EXISTS key_counts;
@@ -0,0 +1,5 @@
+-- Per-key and per-bigram counts from the keystroke replay, so that error
+-- rates can be worked out across matches. NULL for unverified results.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS key_counts JSONB;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bigram_counts JSONB;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bad_bigrams JSONB;
@@ -0,0 +1,10 @@
+// Package migrations holds the SQL schema migrations, embedded into the
+// binary so that it can bring a database up to date on its own.
+package migrations
+
+import "embed"
+
+// Files are the NNN_name.up.sql and NNN_name.down.sql migrations
+//
+//go:embed *.sql
+var Files embed.FS
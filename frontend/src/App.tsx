@@ -1,29 +1,73 @@
-import { useEffect, useState } from 'react'
+import { useEffect, useRef, useState } from 'react'
+import { AchievementToast, type AchievementUnlock } from './components/AchievementToast'
 import { FooterStatus } from './components/FooterStatus'
+import { RaceArena } from './components/RaceArena'
 import { TypingArena } from './components/TypingArena'
 import { useWebSocket } from './hooks/useWebSocket'
 import { LandingPage } from './pages/LandingPage'
 import { ProfilePage } from './pages/ProfilePage'
-import { getOrCreateProfile } from './utils/auth'
+import { ensureSession, getOrCreateProfile, type UserProfile } from './utils/auth'
 
-type ViewState = 'landing' | 'arena' | 'profile';
+type ViewState = 'landing' | 'arena' | 'race' | 'profile';
 
 function App() {
   const [health, setHealth] = useState<{ status: string; db_status?: string; redis_status?: string } | null>(null)
   const [view, setView] = useState<ViewState>('landing')
-  const { isConnected, sendMessage } = useWebSocket(`${import.meta.env.VITE_API_URL.replace('http', 'ws')}/ws`)
-  const user = getOrCreateProfile()
+  const [user, setUser] = useState<UserProfile>(getOrCreateProfile)
+  const [token, setToken] = useState<string | null>(null)
+  const wsUrl = token
+    ? `${import.meta.env.VITE_API_URL.replace('http', 'ws')}/ws?token=${encodeURIComponent(token)}`
+    : null
+  const { isConnected, lastMessage, session, sendMessage, subscribe } = useWebSocket(wsUrl)
+  const [roomId, setRoomId] = useState('global_arena')
+  // The room the server has us in, as far as we know
+  const joinedRoom = useRef<string | null>(null)
+  const [unlocks, setUnlocks] = useState<AchievementUnlock[]>([])
 
   useEffect(() => {
-    if (isConnected) {
-      // Join lobby as guest
-      sendMessage('join_lobby', {
-        room_id: 'global_arena',
-        user_id: user.id,
-        username: user.username
+    ensureSession()
+      .then(session => {
+        setUser(session.profile)
+        setToken(session.token)
       })
+      .catch(err => console.error("Failed to start session:", err))
+  }, [])
+
+  useEffect(() => {
+    // A resumed session is already back in its room. Otherwise, as on the
+    // first connection or one that reached another server, it is in none,
+    // or has missed events, and joins again below, which also sends the
+    // race's current state.
+    if (session && (!session.resumed || !session.complete)) {
+      joinedRoom.current = null
+    }
+  }, [session])
+
+  useEffect(() => {
+    // Only the race view is in a room; solo tests are not. Joining a room
+    // leaves any other. The server knows who we are from the session token.
+    if (!session || !isConnected) return
+    const room = view === 'race' ? roomId : null
+    if (room === joinedRoom.current) return
+    if (room) {
+      sendMessage('join_lobby', { room_id: room })
+    } else {
+      sendMessage('leave_lobby', {})
     }
-  }, [isConnected, sendMessage, user.id, user.username])
+    joinedRoom.current = room
+  }, [session, isConnected, view, roomId, sendMessage])
+
+  const dismissUnlock = (id: string) => {
+    setUnlocks(prev => prev.filter(u => u.achievement.id !== id))
+  }
+
+  useEffect(() => {
+    if (lastMessage?.type !== 'achievement_unlocked') return
+    const unlock: AchievementUnlock = lastMessage.payload
+    setUnlocks(prev => [...prev.filter(u => u.achievement.id !== unlock.achievement.id), unlock])
+    // Not cleared when the next message arrives, so each toast goes on time
+    setTimeout(() => dismissUnlock(unlock.achievement.id), 6000)
+  }, [lastMessage])
 
   useEffect(() => {
     fetch(`${import.meta.env.VITE_API_URL}/health`)
@@ -36,8 +80,6 @@ function App() {
     console.log("Game Finished:", stats)
     sendMessage('game_end', {
       ...stats,
-      user_id: user.id,
-      room_id: 'global_arena',
       language: 'english',
       raw_wpm: stats.raw_wpm || stats.wpm,
       consistency: stats.consistency || 100,
@@ -48,16 +90,6 @@ function App() {
     // Keep view to show results overlay
   }
 
-  const handleProgress = (stats: any) => {
-    sendMessage('typing_update', {
-      user_id: user.id,
-      room_id: 'global_arena',
-      wpm: stats.wpm,
-      progress: stats.progress,
-      accuracy: 100
-    })
-  }
-
   return (
     <div className="min-h-screen w-full flex flex-col relative overflow-hidden font-sans text-zinc-200 bg-zinc-950">
 
@@ -70,6 +102,12 @@ function App() {
           <span className="font-mono font-bold text-xl tracking-tighter">TYPEMASTER_v1</span>
         </div>
         <div className="flex gap-6 text-sm font-mono text-zinc-500 items-center">
+          <button
+            onClick={() => setView(view === 'race' ? 'arena' : 'race')}
+            className="text-zinc-400 hover:text-white transition-colors"
+          >
+            {view === 'race' ? 'SOLO' : 'RACE'}
+          </button>
           <button
             onClick={() => setView('profile')}
             className="text-zinc-400 hover:text-white transition-colors flex items-center gap-2"
@@ -81,13 +119,22 @@ function App() {
 
       <main className="flex-1 flex flex-col items-center justify-center p-4 relative z-10 w-full">
         {view === 'landing' && (
-          <LandingPage onStart={() => setView('arena')} />
+          <LandingPage onStart={() => setView('arena')} onRace={() => setView('race')} />
         )}
 
         {view === 'arena' && (
           <TypingArena
             onComplete={handleGameComplete}
-            onProgress={handleProgress}
+          />
+        )}
+
+        {view === 'race' && (
+          <RaceArena
+            roomId={roomId}
+            userId={user.id}
+            subscribe={subscribe}
+            sendMessage={sendMessage}
+            onJoinRoom={setRoomId}
           />
         )}
 
@@ -99,6 +146,8 @@ function App() {
         )}
       </main>
 
+      <AchievementToast unlocks={unlocks} onDismiss={dismissUnlock} />
+
       <FooterStatus health={health} isConnected={isConnected} />
     </div>
   )
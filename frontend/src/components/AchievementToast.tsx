@@ -0,0 +1,41 @@
+import React from 'react';
+
+export interface AchievementUnlock {
+  achievement: {
+    id: string;
+    title: string;
+    description: string;
+    icon: string;
+  };
+  xp: number;
+  level: number;
+}
+
+interface AchievementToastProps {
+  unlocks: AchievementUnlock[];
+  onDismiss: (id: string) => void;
+}
+
+export const AchievementToast: React.FC<AchievementToastProps> = ({ unlocks, onDismiss }) => {
+  if (unlocks.length === 0) return null;
+
+  return (
+    <div className="fixed top-20 right-6 flex flex-col gap-3 z-50">
+      {unlocks.map(({ achievement, xp, level }) => (
+        <button
+          key={achievement.id}
+          onClick={() => onDismiss(achievement.id)}
+          className="flex items-center gap-4 text-left bg-zinc-900/90 border border-yellow-400/30 rounded-xl px-5 py-4 shadow-lg backdrop-blur-md font-mono animate-pulse"
+        >
+          <span className="text-3xl">{achievement.icon}</span>
+          <div className="flex flex-col">
+            <span className="text-xs text-yellow-400 uppercase tracking-widest">Achievement unlocked</span>
+            <span className="text-white font-bold">{achievement.title}</span>
+            <span className="text-xs text-zinc-500">{achievement.description}</span>
+            <span className="text-xs text-zinc-400 mt-1">LVL {level} · {xp} XP</span>
+          </div>
+        </button>
+      ))}
+    </div>
+  );
+};
@@ -0,0 +1,349 @@
+import React, { useCallback, useEffect, useRef, useState } from 'react';
+import type { WSEvent, WSListener } from '../hooks/useWebSocket';
+import type { PassageSpec } from '../utils/words';
+import type { Keystroke } from './TypingArena';
+
+// The race's state as the server runs it: waiting for everyone to be ready,
+// counting down to a shared start, running until everyone finishes or time
+// runs out, then finished with the final standings.
+type RaceState = 'waiting' | 'countdown' | 'running' | 'finished';
+
+interface Racer {
+  user_id: string;
+  username: string;
+  ready: boolean;
+  racing: boolean; // Took part in the current race from its start
+  finished: boolean;
+  wpm: number;
+  progress: number;
+}
+
+interface Standing {
+  rank: number;
+  user_id: string;
+  username: string;
+  wpm: number;
+  accuracy: number;
+  progress: number;
+  finished: boolean;
+  time_ms: number;
+  unranked?: boolean;
+}
+
+interface Race {
+  state: RaceState;
+  passage: PassageSpec | null;
+  text: string;
+  startAt: number; // Unix milliseconds
+  timeLimit: number; // Seconds
+  racers: Record<string, Racer>;
+  standings: Standing[];
+}
+
+const NO_RACE: Race = {
+  state: 'waiting',
+  passage: null,
+  text: '',
+  startAt: 0,
+  timeLimit: 0,
+  racers: {},
+  standings: [],
+};
+
+const newRacer = (user_id: string, username: string): Racer => ({
+  user_id, username, ready: false, racing: false, finished: false, wpm: 0, progress: 0,
+});
+
+const byId = (racers: Racer[]): Record<string, Racer> => {
+  const map: Record<string, Racer> = {};
+  for (const r of racers) map[r.user_id] = r;
+  return map;
+};
+
+// nextRound keeps a finished race's members and nothing else
+const nextRound = (race: Race): Race => ({
+  ...NO_RACE,
+  racers: byId(Object.values(race.racers).map(r => newRacer(r.user_id, r.username))),
+});
+
+// applyEvent folds one server event into the race. The server decides every
+// transition; the client only follows.
+const applyEvent = (race: Race, message: WSEvent): Race => {
+  const p = message.payload;
+  switch (message.type) {
+    case 'race_state':
+      return {
+        ...race,
+        state: p.state,
+        passage: p.state === 'waiting' ? null : p.passage,
+        text: p.state === 'waiting' ? '' : p.text,
+        startAt: p.start_at,
+        timeLimit: p.time_limit,
+        racers: byId(p.participants ?? []),
+      };
+    case 'player_joined':
+      if (race.racers[p.user_id]) return race;
+      return { ...race, racers: { ...race.racers, [p.user_id]: newRacer(p.user_id, p.username) } };
+    case 'player_left': {
+      const racers = { ...race.racers };
+      delete racers[p.user_id];
+      return { ...race, racers };
+    }
+    case 'player_ready': {
+      // The first to be ready after a race starts the next round, as on the
+      // server
+      const round = race.state === 'finished' ? nextRound(race) : race;
+      const racer = round.racers[p.user_id] ?? newRacer(p.user_id, p.username);
+      return { ...round, racers: { ...round.racers, [p.user_id]: { ...racer, ready: true } } };
+    }
+    case 'game_start':
+      return {
+        state: 'countdown',
+        passage: p.passage,
+        text: p.text,
+        startAt: p.start_at,
+        timeLimit: p.time_limit,
+        racers: byId(Object.values(race.racers).map(r => ({ ...r, racing: true, finished: false, wpm: 0, progress: 0 }))),
+        standings: [],
+      };
+    case 'progress': {
+      const racer = race.racers[p.user_id];
+      if (!racer) return race;
+      return { ...race, racers: { ...race.racers, [p.user_id]: { ...racer, wpm: p.wpm, progress: p.progress } } };
+    }
+    case 'race_result': {
+      const racer = race.racers[p.user_id];
+      if (!racer) return race;
+      return { ...race, racers: { ...race.racers, [p.user_id]: { ...racer, finished: true, wpm: p.wpm, progress: 100 } } };
+    }
+    case 'game_results':
+      return { ...race, state: 'finished', standings: p.standings ?? [] };
+    default:
+      return race;
+  }
+};
+
+interface RaceArenaProps {
+  roomId: string;
+  userId: string;
+  subscribe: (listener: WSListener) => () => void;
+  sendMessage: (type: 'player_ready' | 'typing_update' | 'game_end', payload: any) => void;
+  onJoinRoom: (roomId: string) => void;
+}
+
+// RaceArena races everyone in a room on the passage the server picks. The
+// server starts the countdown once every member is ready, and the race at
+// the same moment for everyone.
+export const RaceArena = ({ roomId, userId, subscribe, sendMessage, onJoinRoom }: RaceArenaProps) => {
+  const [race, setRace] = useState<Race>(NO_RACE);
+  const [now, setNow] = useState(Date.now());
+  const [roomInput, setRoomInput] = useState(roomId);
+
+  const [input, setInput] = useState('');
+  const [done, setDone] = useState(false);
+  const [errors, setErrors] = useState(0);
+  const keystrokes = useRef<Keystroke[]>([]);
+  const firstKeyTime = useRef<number | null>(null);
+  const inputRef = useRef<HTMLInputElement>(null);
+
+  // Joining another room starts from nothing; its race_state follows
+  useEffect(() => {
+    setRace(NO_RACE);
+    setRoomInput(roomId);
+  }, [roomId]);
+
+  useEffect(() => subscribe(message => {
+    if (message.payload?.room_id !== undefined && message.payload.room_id !== roomId) return;
+    if (message.type === 'game_start') {
+      setInput('');
+      setDone(false);
+      setErrors(0);
+      keystrokes.current = [];
+      firstKeyTime.current = null;
+    }
+    setRace(prev => applyEvent(prev, message));
+  }), [subscribe, roomId]);
+
+  useEffect(() => {
+    const tick = setInterval(() => setNow(Date.now()), 200);
+    return () => clearInterval(tick);
+  }, []);
+
+  // The server moves the race from countdown to running at startAt without
+  // saying so; every client sees the same clock.
+  const endAt = race.startAt + race.timeLimit * 1000;
+  const running = (race.state === 'countdown' || race.state === 'running') && race.startAt > 0 && now >= race.startAt && now < endAt;
+  const me = race.racers[userId];
+  const racing = running && !!me?.racing && !done;
+
+  useEffect(() => {
+    if (racing) inputRef.current?.focus();
+  }, [racing]);
+
+  const stats = useCallback((typed: string, errorCount: number, at: number) => {
+    const minutes = Math.max((at - race.startAt) / 60000, 1 / 30);
+    return {
+      wpm: Math.max(0, Math.round(((typed.length - errorCount) / 5) / minutes)),
+      raw_wpm: Math.round((typed.length / 5) / minutes),
+      accuracy: typed.length > 0 ? Math.round(((typed.length - errorCount) / typed.length) * 100) : 100,
+    };
+  }, [race.startAt]);
+
+  const handleChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+    if (!racing) return;
+    const val = e.target.value;
+    const at = Date.now();
+
+    if (firstKeyTime.current === null) {
+      firstKeyTime.current = at;
+    }
+    const t = at - firstKeyTime.current;
+    let errorCount = errors;
+    if (val.length > input.length) {
+      for (const k of val.slice(input.length)) {
+        keystrokes.current.push({ k, t });
+      }
+      const i = val.length - 1;
+      if (val[i] !== race.text[i]) {
+        errorCount++;
+        setErrors(errorCount);
+      }
+    } else {
+      for (let i = val.length; i < input.length; i++) {
+        keystrokes.current.push({ k: 'Backspace', t });
+      }
+    }
+    setInput(val);
+
+    const current = stats(val, errorCount, at);
+    const progress = Math.round((val.length / race.text.length) * 100);
+    sendMessage('typing_update', { wpm: current.wpm, accuracy: current.accuracy, progress });
+
+    if (val.length >= race.text.length) {
+      setDone(true);
+      // The race's time limit caps the duration, and the server checks the
+      // keystrokes against it
+      const duration = Math.min(race.timeLimit, Math.ceil((at - race.startAt) / 1000));
+      sendMessage('game_end', {
+        ...current,
+        duration,
+        error_count: errorCount,
+        passage: race.passage,
+        keystrokes: keystrokes.current,
+      });
+    }
+  };
+
+  const joinRoom = (e: React.FormEvent) => {
+    e.preventDefault();
+    const room = roomInput.trim();
+    if (room && room !== roomId) onJoinRoom(room);
+  };
+
+  const racers = Object.values(race.racers).sort((a, b) => a.username.localeCompare(b.username));
+  const canReady = (race.state === 'waiting' || race.state === 'finished') && !(race.state === 'waiting' && me?.ready);
+  const countdown = race.state === 'countdown' && now < race.startAt ? Math.ceil((race.startAt - now) / 1000) : null;
+  const timeLeft = running ? Math.ceil((endAt - now) / 1000) : race.timeLimit;
+
+  return (
+    <div className="w-full max-w-6xl mx-auto p-8 flex flex-col gap-10 min-h-[60vh] justify-center">
+
+      {/* Room */}
+      <div className="flex justify-between items-center font-mono">
+        <form onSubmit={joinRoom} className="flex gap-2 items-center bg-zinc-900/40 p-2 rounded-full backdrop-blur-sm border border-white/5">
+          <span className="text-[10px] tracking-widest text-zinc-500 uppercase pl-3">Room</span>
+          <input
+            value={roomInput}
+            onChange={e => setRoomInput(e.target.value)}
+            disabled={race.state === 'countdown' || running}
+            className="bg-transparent text-white text-sm px-2 py-1 outline-none w-40"
+          />
+          <button type="submit" className="text-xs uppercase px-4 py-2 rounded-full text-zinc-500 hover:text-zinc-300 hover:bg-zinc-800/50 transition-all">
+            join
+          </button>
+        </form>
+        <div className="text-xs text-zinc-500 uppercase tracking-widest">{race.state}</div>
+      </div>
+
+      {/* Racers */}
+      <div className="flex flex-col gap-3 font-mono">
+        {racers.map(r => (
+          <div key={r.user_id} className="flex items-center gap-4">
+            <span className={`w-40 truncate text-sm ${r.user_id === userId ? 'text-yellow-400' : 'text-zinc-300'}`}>{r.username}</span>
+            <div className="flex-1 h-2 bg-zinc-800 rounded-full overflow-hidden">
+              <div className="h-full bg-yellow-400 transition-all" style={{ width: `${r.racing ? r.progress : 0}%` }}></div>
+            </div>
+            <span className="w-20 text-right text-sm text-white tabular-nums">{r.racing ? `${r.wpm} WPM` : ''}</span>
+            <span className="w-24 text-right text-[10px] tracking-widest uppercase text-zinc-500">
+              {r.finished ? 'finished' : r.racing ? '' : r.ready ? <span className="text-green-400">ready</span> : 'waiting'}
+            </span>
+          </div>
+        ))}
+      </div>
+
+      {/* Countdown, clock and ready */}
+      <div className="flex justify-between items-center font-mono px-4">
+        <div className="text-6xl font-bold tracking-tighter text-yellow-400 tabular-nums">
+          {countdown !== null ? countdown : running ? timeLeft : ''}
+        </div>
+        {canReady && (
+          <button
+            onClick={() => sendMessage('player_ready', {})}
+            className="px-8 py-4 bg-white text-black font-bold rounded-xl hover:bg-zinc-200 transition-all hover:scale-[1.02] font-mono text-lg shadow-xl"
+          >
+            READY
+          </button>
+        )}
+        {race.state === 'waiting' && me?.ready && (
+          <span className="text-zinc-500 text-sm">Waiting for everyone to be ready…</span>
+        )}
+        {race.state !== 'waiting' && race.state !== 'finished' && !me?.racing && (
+          <span className="text-zinc-500 text-sm">Race in progress; you can join the next one.</span>
+        )}
+      </div>
+
+      {/* Passage */}
+      {race.text && race.state !== 'finished' && (
+        <div
+          className="relative font-mono text-3xl leading-[1.8] outline-none min-h-[200px] select-none"
+          onClick={() => inputRef.current?.focus()}
+        >
+          <div className={`relative whitespace-pre-wrap break-words ${racing ? 'text-zinc-600' : 'text-zinc-700'}`}>
+            {race.text.split('').map((char, i) => (
+              <span key={i} className={i < input.length ? (input[i] === char ? 'text-white' : 'text-red-500') : ''}>
+                {char}
+              </span>
+            ))}
+          </div>
+          <input
+            ref={inputRef}
+            type="text"
+            value={input}
+            onChange={handleChange}
+            disabled={!racing}
+            className="absolute opacity-0 top-0 left-0 h-full w-full cursor-default"
+            autoComplete="off"
+          />
+        </div>
+      )}
+
+      {/* Standings */}
+      {race.state === 'finished' && race.standings.length > 0 && (
+        <div className="bg-zinc-900 border border-zinc-800 p-8 rounded-3xl space-y-4 font-mono">
+          <h2 className="text-2xl font-bold text-white tracking-tighter">RACE_RESULTS</h2>
+          {race.standings.map(s => (
+            <div key={s.user_id} className="flex items-center gap-4 text-sm">
+              <span className="w-8 text-yellow-400 font-bold">{s.rank > 0 ? `#${s.rank}` : '–'}</span>
+              <span className={`flex-1 truncate ${s.user_id === userId ? 'text-yellow-400' : 'text-zinc-300'}`}>{s.username}</span>
+              <span className="w-20 text-right text-white tabular-nums">{s.wpm} WPM</span>
+              <span className="w-16 text-right text-zinc-400 tabular-nums">{Math.round(s.accuracy)}%</span>
+              <span className="w-24 text-right text-zinc-500">
+                {s.unranked ? 'unverified' : s.finished ? `${(s.time_ms / 1000).toFixed(1)}s` : `${s.progress}%`}
+              </span>
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+};
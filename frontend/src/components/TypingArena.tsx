@@ -1,6 +1,12 @@
 import React, { useCallback, useEffect, useRef, useState } from 'react';
-import type { Difficulty as DifficultyType } from '../utils/words';
-import { generateWords } from '../utils/words';
+import type { Difficulty as DifficultyType, PassageSpec } from '../utils/words';
+import { getSessionToken } from '../utils/auth';
+import { fetchPassage, fetchPracticePassage, generateWords, wordsFor } from '../utils/words';
+
+export interface Keystroke {
+  k: string; // Typed character, or 'Backspace'
+  t: number; // Milliseconds since the first keystroke
+}
 
 interface TypingArenaProps {
   onComplete: (stats: {
@@ -14,15 +20,19 @@ interface TypingArenaProps {
     error_count: number;
     bad_keys: Record<string, number>;
     improvement_needed: string;
+    passage: PassageSpec | null;
+    keystrokes: Keystroke[];
   }) => void;
-  onProgress: (stats: { wpm: number; progress: number }) => void;
+  onProgress?: (stats: { wpm: number; progress: number }) => void;
 }
 
 export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
   const [difficulty, setDifficulty] = useState<DifficultyType>('medium');
   const [duration, setDuration] = useState(30);
+  const [practice, setPractice] = useState(false);
 
   const [text, setText] = useState('');
+  const [passage, setPassage] = useState<PassageSpec | null>(null);
   const [input, setInput] = useState('');
   const [timeLeft, setTimeLeft] = useState(duration);
   const [isActive, setIsActive] = useState(false);
@@ -39,10 +49,27 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
   const timerRef = useRef<number | null>(null);
   const keyIntervals = useRef<number[]>([]);
   const lastKeyTime = useRef<number | null>(null);
+  const firstKeyTime = useRef<number | null>(null);
+  const keystrokes = useRef<Keystroke[]>([]);
 
   const startGame = useCallback(() => {
-    const newText = generateWords(difficulty, 100); // Generate more words to prevent running out
-    setText(newText);
+    // Generate enough words that no one runs out before the time is up. Only
+    // a result typed on the server passage is accepted; the local one is a
+    // fallback for when it cannot be fetched.
+    setText(generateWords(difficulty, wordsFor(duration)));
+    setPassage(null);
+    const token = getSessionToken();
+    const request = practice && token
+      ? fetchPracticePassage(difficulty, duration, token)
+      : fetchPassage(difficulty, duration, token);
+    request
+      .then(p => {
+        if (firstKeyTime.current === null) {
+          setText(p.text);
+          setPassage({ seed: p.seed, difficulty: p.difficulty, words: p.words, focus: p.focus });
+        }
+      })
+      .catch(err => console.error("Failed to fetch passage:", err));
     setInput('');
     setTimeLeft(duration);
     setIsActive(false);
@@ -55,9 +82,11 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
     setBadKeys({});
     keyIntervals.current = [];
     lastKeyTime.current = null;
+    firstKeyTime.current = null;
+    keystrokes.current = [];
 
     setTimeout(() => inputRef.current?.focus(), 10);
-  }, [difficulty, duration]);
+  }, [difficulty, duration, practice]);
 
   useEffect(() => {
     startGame();
@@ -110,12 +139,14 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
       raw_wpm: rawWpm,
       accuracy,
       duration: duration - timeLeft,
-      mode: `time_${duration}`,
+      mode: practice ? 'practice' : `time_${duration}`,
       difficulty,
       consistency: finalConsistency,
       error_count: errors,
       bad_keys: badKeys,
-      improvement_needed: improvementNeeded
+      improvement_needed: improvementNeeded,
+      passage,
+      keystrokes: keystrokes.current
     });
   };
 
@@ -136,6 +167,20 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
     }
     lastKeyTime.current = now;
 
+    if (firstKeyTime.current === null) {
+      firstKeyTime.current = now;
+    }
+    const t = now - firstKeyTime.current;
+    if (val.length > input.length) {
+      for (const k of val.slice(input.length)) {
+        keystrokes.current.push({ k, t });
+      }
+    } else {
+      for (let i = val.length; i < input.length; i++) {
+        keystrokes.current.push({ k: 'Backspace', t });
+      }
+    }
+
     const isAddition = val.length > input.length;
     if (isAddition) {
       const charIndex = val.length - 1;
@@ -174,7 +219,7 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
     setAccuracy(currentAccuracy);
 
     const progress = Math.round((val.length / text.length) * 100);
-    onProgress({ wpm: netWpm, progress });
+    onProgress?.({ wpm: netWpm, progress });
 
     if (val.length >= text.length) {
       finishGame();
@@ -219,6 +264,20 @@ export const TypingArena = ({ onComplete, onProgress }: TypingArenaProps) => {
             ))}
           </div>
           <div className="w-px h-6 bg-white/10 mx-2"></div>
+          <div className="flex gap-1 p-1">
+            <button
+              onClick={() => setPractice(p => !p)}
+              title="Drill the keys you miss most"
+              className={`text-xs font-mono uppercase px-4 py-2 rounded-full transition-all ${
+                practice
+                  ? 'bg-zinc-800 text-white font-bold shadow-lg'
+                  : 'text-zinc-500 hover:text-zinc-300 hover:bg-zinc-800/50'
+              }`}
+            >
+              practice
+            </button>
+          </div>
+          <div className="w-px h-6 bg-white/10 mx-2"></div>
           <div className="flex gap-1 p-1">
             {[15, 30, 60].map((t) => (
               <button
@@ -1,54 +1,165 @@
 import { useCallback, useEffect, useRef, useState } from 'react';
 
-type WSEventType =
+// The protocol version this client speaks and the optional features it
+// understands, announced in the hello that opens every connection.
+const PROTOCOL_VERSION = 1;
+const PROTOCOL_FEATURES = ['resume', 'errors'];
+
+// Close code for a protocol version the server no longer supports. Only a
+// reload, which fetches a newer client, can fix it.
+const CLOSE_UNSUPPORTED_VERSION = 4000;
+
+// Events the client sends
+type WSClientEventType =
   | 'join_lobby'
   | 'leave_lobby'
   | 'chat_message'
   | 'typing_update'
+  | 'player_ready'
+  | 'game_end';
+
+// Events the server sends
+type WSEventType =
+  | 'welcome'
+  | 'player_joined'
+  | 'player_left'
+  | 'player_ready'
+  | 'progress'
+  | 'chat'
+  | 'race_result'
   | 'game_start'
-  | 'game_end'
+  | 'game_results'
+  | 'race_state'
+  | 'achievement_unlocked'
+  | 'session'
   | 'error';
 
-interface WSEvent {
+// Codes carried by error events
+export type WSErrorCode =
+  | 'bad_message'
+  | 'unknown_event'
+  | 'invalid_payload'
+  | 'not_in_room'
+  | 'result_rejected'
+  | 'internal_error';
+
+export interface WSEvent {
   type: WSEventType;
   payload: any;
+  seq?: number;
 }
 
-export const useWebSocket = (url: string) => {
+// A listener is called with every event, in order. lastMessage only holds the
+// latest, so events that arrive together may be skipped by anything reading
+// it; a race, which has to see every one, subscribes instead.
+export type WSListener = (message: WSEvent) => void;
+
+// The outcome of the session event that follows every welcome. A session
+// that was not resumed, or whose missed events were not all replayed, has
+// lost track of its room.
+export interface WSSession {
+  resumed: boolean;
+  complete: boolean;
+}
+
+// Reconnect delays grow from MIN to MAX, doubling after each failed attempt.
+const MIN_RECONNECT_DELAY = 500;
+const MAX_RECONNECT_DELAY = 15000;
+
+// useWebSocket connects to url, or waits while url is null. It counts as
+// connected once the server has welcomed its hello. When the connection
+// drops it reconnects with backoff, resuming the server session so that
+// missed events are replayed and the room and race are kept. That only works
+// on the server instance that held the session; session reports how each
+// connection went so the caller can rejoin its room when it did not.
+export const useWebSocket = (url: string | null) => {
   const [isConnected, setIsConnected] = useState(false);
   const [lastMessage, setLastMessage] = useState<WSEvent | null>(null);
+  const [sessionState, setSessionState] = useState<WSSession | null>(null);
   const ws = useRef<WebSocket | null>(null);
+  const session = useRef<{ token: string; lastSeq: number } | null>(null);
+  const listeners = useRef(new Set<WSListener>());
 
   useEffect(() => {
-    const socket = new WebSocket(url);
+    if (!url) {
+      return;
+    }
+    let closed = false;
+    let retry: ReturnType<typeof setTimeout> | undefined;
+    let delay = MIN_RECONNECT_DELAY;
 
-    socket.onopen = () => {
-      console.log('WebSocket Connected');
-      setIsConnected(true);
-    };
+    const connect = () => {
+      const target = new URL(url);
+      if (session.current) {
+        target.searchParams.set('resume', session.current.token);
+        target.searchParams.set('last_seq', String(session.current.lastSeq));
+      }
+      const socket = new WebSocket(target.toString());
 
-    socket.onclose = () => {
-      console.log('WebSocket Disconnected');
-      setIsConnected(false);
-    };
+      socket.onopen = () => {
+        socket.send(JSON.stringify({
+          type: 'hello',
+          payload: { version: PROTOCOL_VERSION, features: PROTOCOL_FEATURES },
+        }));
+      };
 
-    socket.onmessage = (event) => {
-      try {
-        const message: WSEvent = JSON.parse(event.data);
-        setLastMessage(message);
-      } catch (e) {
-        console.error('Failed to parse WS message:', event.data);
-      }
+      socket.onclose = (event) => {
+        console.log('WebSocket Disconnected');
+        setIsConnected(false);
+        if (event.code === CLOSE_UNSUPPORTED_VERSION) {
+          console.error(`WebSocket refused: ${event.reason}`);
+          return;
+        }
+        if (closed) {
+          return;
+        }
+        retry = setTimeout(connect, delay);
+        delay = Math.min(delay * 2, MAX_RECONNECT_DELAY);
+      };
+
+      socket.onmessage = (event) => {
+        try {
+          const message: WSEvent = JSON.parse(event.data);
+          if (message.type === 'error') {
+            console.warn(`Server refused ${message.payload.event ?? 'message'}: ${message.payload.code}: ${message.payload.message}`);
+          }
+          if (message.type === 'welcome') {
+            console.log('WebSocket Connected');
+            delay = MIN_RECONNECT_DELAY;
+            setIsConnected(true);
+            return;
+          }
+          if (message.type === 'session') {
+            // A new session restarts the numbering; a resumed one carries on.
+            session.current = {
+              token: message.payload.token,
+              lastSeq: message.payload.resumed ? session.current?.lastSeq ?? 0 : 0,
+            };
+            setSessionState({ resumed: message.payload.resumed, complete: message.payload.complete });
+          } else if (message.seq && session.current) {
+            session.current.lastSeq = message.seq;
+          }
+          setLastMessage(message);
+          listeners.current.forEach(listener => listener(message));
+        } catch (e) {
+          console.error('Failed to parse WS message:', event.data);
+        }
+      };
+
+      ws.current = socket;
     };
 
-    ws.current = socket;
+    connect();
 
     return () => {
-      socket.close();
+      closed = true;
+      clearTimeout(retry);
+      ws.current?.close();
+      session.current = null;
     };
   }, [url]);
 
-  const sendMessage = useCallback((type: WSEventType, payload: any) => {
+  const sendMessage = useCallback((type: WSClientEventType, payload: any) => {
     if (ws.current?.readyState === WebSocket.OPEN) {
       ws.current.send(JSON.stringify({ type, payload }));
     } else {
@@ -56,5 +167,14 @@ export const useWebSocket = (url: string) => {
     }
   }, []);
 
-  return { isConnected, lastMessage, sendMessage };
+  // subscribe adds a listener for every event from now on, returning a
+  // function that removes it.
+  const subscribe = useCallback((listener: WSListener) => {
+    listeners.current.add(listener);
+    return () => {
+      listeners.current.delete(listener);
+    };
+  }, []);
+
+  return { isConnected, lastMessage, session: sessionState, sendMessage, subscribe };
 };
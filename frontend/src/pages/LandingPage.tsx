@@ -3,9 +3,10 @@ import React from 'react';
 
 interface LandingPageProps {
   onStart: () => void;
+  onRace: () => void;
 }
 
-export const LandingPage: React.FC<LandingPageProps> = ({ onStart }) => {
+export const LandingPage: React.FC<LandingPageProps> = ({ onStart, onRace }) => {
   return (
     <div className="w-full max-w-7xl mx-auto px-6 flex flex-col gap-24 py-12 relative overflow-hidden min-h-[80vh] justify-center">
 
@@ -77,6 +78,12 @@ export const LandingPage: React.FC<LandingPageProps> = ({ onStart }) => {
                 ENTER ARENA <span className="text-lg">→</span>
               </span>
             </button>
+            <button
+              onClick={onRace}
+              className="px-8 py-4 border border-zinc-800 text-zinc-400 font-mono font-bold hover:border-zinc-600 hover:text-white transition-all hover:bg-zinc-900 cursor-pointer rounded-sm"
+            >
+              RACE
+            </button>
             <button className="px-8 py-4 border border-zinc-800 text-zinc-400 font-mono font-bold hover:border-zinc-600 hover:text-white transition-all hover:bg-zinc-900 cursor-pointer rounded-sm">
               GLOBAL LEADERBOARD
             </button>
@@ -1,6 +1,5 @@
 import React, { useEffect, useState } from 'react';
 import type { UserProfile } from '../utils/auth';
-import { ACHIEVEMENTS, calculateLevel, getUnlockedAchievements } from '../utils/gamification';
 
 interface MatchHistory {
   id: string;
@@ -21,6 +20,29 @@ interface ProfilePageProps {
   onBack: () => void;
 }
 
+interface ServerStats {
+  total_matches: number;
+  avg_wpm: number;
+  max_wpm: number;
+  avg_accuracy: number;
+}
+
+interface ServerAchievement {
+  id: string;
+  title: string;
+  description: string;
+  icon: string;
+  unlocked_at?: string;
+}
+
+interface ServerProgress {
+  xp: number;
+  level: number;
+  level_xp: number;
+  next_level_xp: number;
+  achievements: ServerAchievement[];
+}
+
 export const ProfilePage: React.FC<ProfilePageProps> = ({ user, onBack }) => {
   const [history, setHistory] = useState<MatchHistory[]>([]);
   const [loading, setLoading] = useState(true);
@@ -43,19 +65,35 @@ export const ProfilePage: React.FC<ProfilePageProps> = ({ user, onBack }) => {
     fetchHistory();
   }, [user.id]);
 
-  const { totalMatches, avgWpm, maxWpm, avgAccuracy } = React.useMemo(() => {
-    const total = history.length;
-    if (total === 0) return { totalMatches: 0, avgWpm: 0, maxWpm: 0, avgAccuracy: 0 };
+  // Lifetime figures come from the server; history only holds recent matches.
+  const [stats, setStats] = useState<ServerStats | null>(null);
 
-    const avgW = Math.round(history.reduce((acc, m) => acc + m.wpm, 0) / total);
-    const maxW = Math.max(...history.map(m => m.wpm));
-    const avgA = Math.round(history.reduce((acc, m) => acc + m.accuracy, 0) / total);
+  useEffect(() => {
+    fetch(`${import.meta.env.VITE_API_URL}/api/stats?user_id=${user.id}`)
+      .then(res => res.json())
+      .then(data => setStats(data))
+      .catch(err => console.error("Failed to fetch stats:", err));
+  }, [user.id, history]);
+
+  // Achievements and XP are awarded by the server as matches are saved.
+  const [progress, setProgress] = useState<ServerProgress | null>(null);
 
-    return { totalMatches: total, avgWpm: avgW, maxWpm: maxW, avgAccuracy: avgA };
-  }, [history]);
+  useEffect(() => {
+    fetch(`${import.meta.env.VITE_API_URL}/api/achievements?user_id=${user.id}`)
+      .then(res => res.json())
+      .then(data => setProgress(data))
+      .catch(err => console.error("Failed to fetch achievements:", err));
+  }, [user.id, history]);
 
-  const currentLevel = calculateLevel(avgWpm);
-  const unlockedAchievements = getUnlockedAchievements({ totalMatches, avgWpm, maxWpm });
+  const totalMatches = stats?.total_matches ?? 0;
+  const avgWpm = Math.round(stats?.avg_wpm ?? 0);
+  const maxWpm = stats?.max_wpm ?? 0;
+  const avgAccuracy = Math.round(stats?.avg_accuracy ?? 0);
+
+  const levelSpan = progress ? progress.next_level_xp - progress.level_xp : 0;
+  const levelPercent = progress && levelSpan > 0
+    ? Math.round(((progress.xp - progress.level_xp) / levelSpan) * 100)
+    : 0;
 
   return (
     <div className="w-full max-w-6xl mx-auto p-8 animate-fade-in">
@@ -70,14 +108,19 @@ export const ProfilePage: React.FC<ProfilePageProps> = ({ user, onBack }) => {
           <div>
             <h1 className="text-4xl font-bold text-white font-mono tracking-tighter flex items-center gap-4">
               {user.username}
-              <span className={`text-sm px-3 py-1 rounded-full border border-zinc-700 bg-zinc-900 ${currentLevel.color}`}>
-                {currentLevel.label}
+              <span className="text-sm px-3 py-1 rounded-full border border-zinc-700 bg-zinc-900 text-yellow-400">
+                LVL {progress?.level ?? 1}
               </span>
             </h1>
             <div className="text-zinc-500 font-mono text-sm flex gap-4 mt-2">
               <span>GUEST_ACCESS</span>
               <span className="text-zinc-700">|</span>
               <span>ID: {user.id.slice(0, 8)}...</span>
+              <span className="text-zinc-700">|</span>
+              <span>{progress?.xp ?? 0} XP</span>
+            </div>
+            <div className="w-48 h-1 bg-zinc-800 rounded-full mt-2 overflow-hidden">
+              <div className="h-full bg-yellow-400" style={{ width: `${levelPercent}%` }}></div>
             </div>
           </div>
         </div>
@@ -107,8 +150,8 @@ export const ProfilePage: React.FC<ProfilePageProps> = ({ user, onBack }) => {
       <div className="mb-12">
         <h2 className="text-lg font-bold text-white font-mono mb-6">ACHIEVEMENTS</h2>
         <div className="grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 lg:grid-cols-5 gap-4">
-          {ACHIEVEMENTS.map((ach) => {
-            const isUnlocked = unlockedAchievements.some(u => u.id === ach.id);
+          {(progress?.achievements ?? []).map((ach) => {
+            const isUnlocked = !!ach.unlocked_at;
             return (
               <div
                 key={ach.id}
@@ -123,6 +166,9 @@ export const ProfilePage: React.FC<ProfilePageProps> = ({ user, onBack }) => {
                   {ach.title}
                 </div>
                 <div className="text-xs text-zinc-500 mt-1">{ach.description}</div>
+                {ach.unlocked_at && (
+                  <div className="text-[10px] text-zinc-600 mt-2">{new Date(ach.unlocked_at).toLocaleDateString()}</div>
+                )}
               </div>
             );
           })}
@@ -31,3 +31,81 @@ export const getOrCreateProfile = (): UserProfile => {
   localStorage.setItem('typemaster_profile', JSON.stringify(newProfile));
   return newProfile;
 };
+
+const TOKEN_KEY = 'typemaster_token';
+
+interface SessionResponse {
+  token: string;
+  expires_at: string;
+  user: { id: string; username: string; is_guest: boolean };
+}
+
+export const getSessionToken = (): string | null => localStorage.getItem(TOKEN_KEY);
+
+const saveSession = (session: SessionResponse): UserProfile => {
+  const profile: UserProfile = {
+    id: session.user.id,
+    username: session.user.username,
+    isGuest: session.user.is_guest,
+  };
+  localStorage.setItem(TOKEN_KEY, session.token);
+  localStorage.setItem('typemaster_profile', JSON.stringify(profile));
+  return profile;
+};
+
+const postAuth = async (path: string, body: object): Promise<SessionResponse> => {
+  const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+  const token = getSessionToken();
+  if (token) {
+    headers.Authorization = `Bearer ${token}`;
+  }
+  const res = await fetch(`${import.meta.env.VITE_API_URL}/api/auth/${path}`, {
+    method: 'POST',
+    headers,
+    body: JSON.stringify(body),
+  });
+  if (!res.ok) {
+    throw new Error((await res.text()).trim() || `Request failed: ${res.status}`);
+  }
+  return res.json();
+};
+
+// ensureSession returns a session token, starting a guest session if there
+// is none. The server assigns the guest's ID; a guest from before sessions
+// starts over as a new guest, since the ID it chose proves nothing.
+export const ensureSession = async (): Promise<{ token: string; profile: UserProfile }> => {
+  const token = getSessionToken();
+  if (token) {
+    const res = await fetch(`${import.meta.env.VITE_API_URL}/api/auth/me`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (res.ok) {
+      return { token, profile: getOrCreateProfile() };
+    }
+    // Expired or logged out elsewhere
+    localStorage.removeItem(TOKEN_KEY);
+  }
+  const session = await postAuth('guest', { username: getOrCreateProfile().username });
+  return { token: session.token, profile: saveSession(session) };
+};
+
+// Registering from a guest session upgrades that guest, keeping its history.
+export const register = async (username: string, email: string, password: string): Promise<UserProfile> => {
+  return saveSession(await postAuth('register', { username, email, password }));
+};
+
+export const login = async (email: string, password: string): Promise<UserProfile> => {
+  return saveSession(await postAuth('login', { email, password }));
+};
+
+export const logout = async (): Promise<void> => {
+  const token = getSessionToken();
+  localStorage.removeItem(TOKEN_KEY);
+  localStorage.removeItem('typemaster_profile');
+  if (token) {
+    await fetch(`${import.meta.env.VITE_API_URL}/api/auth/logout`, {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${token}` },
+    });
+  }
+};
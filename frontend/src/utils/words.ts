@@ -66,3 +66,42 @@ export const generateWords = (difficulty: Difficulty, count: number): string =>
 
   return words.join(' ');
 };
+
+export interface PassageSpec {
+  seed: number;
+  difficulty: Difficulty;
+  words: number;
+  focus?: string[]; // Keys and bigrams a practice drill is weighted toward
+}
+
+export interface Passage extends PassageSpec {
+  text: string;
+}
+
+// Words needed so that no one runs out of text in a timed test, matching
+// the server's sizing for the fastest human typist.
+export const wordsFor = (duration: number): number => Math.min(500, Math.ceil(duration * 250 / 60));
+
+// Fetches a seeded passage long enough for a test of duration seconds. Sent
+// with the session token, it is the passage the server checks the result
+// against.
+export const fetchPassage = async (difficulty: Difficulty, duration: number, token: string | null): Promise<Passage> => {
+  const res = await fetch(`${import.meta.env.VITE_API_URL}/api/passage?difficulty=${difficulty}&duration=${duration}`, {
+    headers: token ? { Authorization: `Bearer ${token}` } : {},
+  });
+  if (!res.ok) {
+    throw new Error(`Failed to fetch passage: ${res.status}`);
+  }
+  return res.json();
+};
+
+// Fetches a practice drill weighted toward the signed-in user's weak keys.
+export const fetchPracticePassage = async (difficulty: Difficulty, duration: number, token: string): Promise<Passage> => {
+  const res = await fetch(`${import.meta.env.VITE_API_URL}/api/practice?difficulty=${difficulty}&duration=${duration}`, {
+    headers: { Authorization: `Bearer ${token}` },
+  });
+  if (!res.ok) {
+    throw new Error(`Failed to fetch practice passage: ${res.status}`);
+  }
+  return res.json();
+};